@@ -1,11 +1,22 @@
 package gojobcoordinatortest
 
+import "time"
+
 // API用のJSONフォーマット
 
 // TaskStartRequest TaskRunnerにタスク開始リクエストを行う時のリクエストデータ
+// CallbackURLの指定がある場合、タスク完了時にTaskStatusResponseがそのURLへPOSTされる
+// TimeoutSecはタスク開始からの制限秒数、Deadlineは終了すべき時刻を表す。どちらかを過ぎたタスクはキャンセルされStatusTimedOutとなる
+// JobID,TaskIndex,AttemptはCoordinatorがジョブのタスクを開始する際に設定し、タスクへTaskMetadataとして渡される
 type TaskStartRequest struct {
-	ProcName string                  `json:"procName"`
-	Params   *map[string]interface{} `json:"params"`
+	ProcName    string                  `json:"procName"`
+	Params      *map[string]interface{} `json:"params"`
+	CallbackURL string                  `json:"callbackURL,omitempty"`
+	TimeoutSec  float64                 `json:"timeoutSec,omitempty"`
+	Deadline    *time.Time              `json:"deadline,omitempty"`
+	JobID       string                  `json:"jobID,omitempty"`
+	TaskIndex   int                     `json:"taskIndex,omitempty"`
+	Attempt     int                     `json:"attempt,omitempty"`
 }
 
 // TaskStartResponse TaskRunnerにタスク開始APIを叩いた時のレスポンス
@@ -13,11 +24,51 @@ type TaskStartResponse struct {
 	ID string `json:"id"`
 }
 
+// TaskStartError タスク開始が拒否された時のレスポンス兼エラー
+// Reasonには拒否理由が入る。TaskRunnerはタスク開始APIでこのエラーをJSONで返す
+type TaskStartError struct {
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+const (
+	// TaskStartRejectCapacity 実行中タスク数が上限に達しているためにタスク開始が拒否された時の理由
+	TaskStartRejectCapacity string = "CapacityExhausted"
+	// TaskStartRejectUnknownProc 処理名に対応するタスクファクトリが存在しないためにタスク開始が拒否された時の理由
+	TaskStartRejectUnknownProc string = "UnknownProc"
+	// TaskStartRejectInvalidParams タスクファクトリがパラメータを受け付けなかったためにタスク開始が拒否された時の理由
+	TaskStartRejectInvalidParams string = "InvalidParams"
+	// TaskStartRejectUnschedulable 処理名に対応するTaskRunnerがCoordinatorに接続されていない時の理由
+	TaskStartRejectUnschedulable string = "Unschedulable"
+)
+
+func (e *TaskStartError) Error() string {
+	return e.Message
+}
+
+// IsPermanent 再試行しても開始できない拒否理由かを調べる
+func (e *TaskStartError) IsPermanent() bool {
+	return e.Reason != TaskStartRejectCapacity
+}
+
 // TaskStatusResponse TaskRunnerにタスクの状態確認APIを叩いた時のレスポンス
+// Progressにはタスクが最後に報告した進捗が入る。報告していない場合はnilとなる
 type TaskStatusResponse struct {
+	ID string `json:"id"`
 	TaskStartRequest
 	Status       string                  `json:"status"`
 	ResultValues *map[string]interface{} `json:"resultValues"`
+	Progress     *TaskProgress           `json:"progress,omitempty"`
+}
+
+// TaskProgress タスクの進捗
+// Fractionは0から1までの完了した割合、Messageは進捗の短い説明、Valuesは任意の値を表す
+// UpdatedAtにはTaskRunnerが進捗を受け取った時刻が入る
+type TaskProgress struct {
+	Fraction  float64                 `json:"fraction"`
+	Message   string                  `json:"message,omitempty"`
+	Values    *map[string]interface{} `json:"values,omitempty"`
+	UpdatedAt time.Time               `json:"updatedAt"`
 }
 
 const (
@@ -27,6 +78,10 @@ const (
 	StatusFailure string = "StatusFailure"
 	// StatusBusy Taskが実行中な時にTaskStatusResponseのStatusで返される値
 	StatusBusy string = "StatusBusy"
+	// StatusTimedOut Taskが制限時間を過ぎて終了している時にTaskStatusResponseのStatusで返される値
+	StatusTimedOut string = "StatusTimedOut"
+	// StatusCancelled Taskがキャンセルにより終了している時にTaskStatusResponseのStatusで返される値
+	StatusCancelled string = "StatusCancelled"
 )
 
 // TaskListResponse TaskRunnerにタスク一覧取得を行った時のレスポンス
@@ -34,17 +89,124 @@ type TaskListResponse struct {
 	Tasks []string `json:"tasks"`
 }
 
+// TaskProcListResponse TaskRunnerに実行可能な処理名の一覧取得を行った時のレスポンス
+type TaskProcListResponse struct {
+	Procs []string `json:"procs"`
+}
+
+// TaskRunnerLabelsResponse TaskRunnerにラベルの取得を行った時のレスポンス
+type TaskRunnerLabelsResponse struct {
+	Labels map[string]string `json:"labels"`
+}
+
+// TaskRunnerSchemasResponse TaskRunnerにパラメータのスキーマの取得を行った時のレスポンス
+// Schemasにはスキーマが登録されている処理名ごとのスキーマが入る
+type TaskRunnerSchemasResponse struct {
+	Schemas map[string]*ParamsSchema `json:"schemas"`
+}
+
+// TaskRunnerInfoResponse TaskRunnerに設定と負荷状況の取得を行った時のレスポンス
+// Versionにはタスクランナーのバージョン、Procsには実行可能な処理名、Labelsにはラベル、Schemasには処理名ごとのパラメータのスキーマが入る
+type TaskRunnerInfoResponse struct {
+	Version string                   `json:"version"`
+	Procs   []string                 `json:"procs"`
+	Labels  map[string]string        `json:"labels,omitempty"`
+	Schemas map[string]*ParamsSchema `json:"schemas,omitempty"`
+	TaskRunnerStatsResponse
+}
+
 // TaskRunnerConnectionRequest コーディネーターサーバーにTaskRunnerを接続・解除する際のリクエスト
 type TaskRunnerConnectionRequest struct {
 	Address string `json:"address"`
 }
 
+// TaskRunnerRegisterRequest TaskRunnerが自身をコーディネーターサーバーへ登録する際のリクエスト
+// TaskRunnerInfoResponseには登録時のTaskRunnerの情報が入る
+type TaskRunnerRegisterRequest struct {
+	Address string `json:"address"`
+	TaskRunnerInfoResponse
+}
+
+// TaskRunnerHeartbeatRequest 登録したTaskRunnerがコーディネーターサーバーへ定期的に送る生存通知
+// ActiveTaskNum,TaskNumMaxには送信時の負荷状況が入る
+type TaskRunnerHeartbeatRequest struct {
+	Address string `json:"address"`
+	TaskRunnerStatsResponse
+}
+
+// TaskRunnerHeartbeatResponse 生存通知に対するコーディネーターサーバーからのレスポンス
+// StateにはコーディネーターサーバーでのTaskRunnerの状態としてRunnerState〜の値が入る
+type TaskRunnerHeartbeatResponse struct {
+	State string `json:"state"`
+}
+
 // JobStartRequest コーディネーターサーバーに送るジョブ開始リクエスト
-// TargetFiltersの指定がある場合、指定されたフィルターリストのどれかに部分一致するタスクランナーが実行対象となる
-// 指定がない場合はコーディネーターに接続された全TaskRunnerを対象とする。
+// Selectorの指定がある場合、ラベルがSelectorに一致するTaskRunnerが実行対象となる
+// TargetFiltersは互換性のために残しているもので、指定がある場合はアドレスがフィルターリストのどれかに部分一致するTaskRunnerに絞り込む
+// どちらも指定がない場合はコーディネーターに接続された全TaskRunnerを対象とする。
+// RetryPolicyはRetryPolicyの指定がないタスクに適用される。どちらも指定がない場合は再試行しない。
+// TimeoutSecはジョブ開始からの制限秒数、Deadlineはジョブが終了すべき時刻を表す。割り当て待ちの時間も含まれる
+// 過ぎた場合は割り当て待ちのタスクを諦め、実行中のタスクはキャンセルされる。ジョブ開始時にTimeoutSecから求めた時刻がDeadlineに反映される
 type JobStartRequest struct {
-	Tasks         []TaskStartRequest `json:"tasks"`
-	TargetFilters *[]string          `json:"targetFilters"`
+	Tasks         []JobTaskRequest `json:"tasks"`
+	TargetFilters *[]string        `json:"targetFilters"`
+	Selector      LabelSelector    `json:"selector,omitempty"`
+	RetryPolicy   *RetryPolicy     `json:"retryPolicy,omitempty"`
+	TimeoutSec    float64          `json:"timeoutSec,omitempty"`
+	Deadline      *time.Time       `json:"deadline,omitempty"`
+}
+
+// JobTaskRequest ジョブ開始リクエストに含めるタスク
+// TaskRunnerへ送るTaskStartRequestに加え、Coordinatorがタスクを管理するための設定を持つ
+// DependsOnに指定したIDのタスクがすべて成功してからこのタスクを開始する。依存先が失敗した場合このタスクはスキップされる
+// IDは他のタスクのDependsOnから参照する場合に指定する
+// Paramsの文字列には依存先タスクの結果値を参照するプレースホルダ ${タスクID.結果値名} を含めることができ、タスク開始直前に解決される
+// SelectorはJobStartRequestのSelectorに加えてこのタスクの実行対象を絞り込む
+type JobTaskRequest struct {
+	TaskStartRequest
+	ID          string        `json:"id,omitempty"`
+	DependsOn   []string      `json:"dependsOn,omitempty"`
+	Selector    LabelSelector `json:"selector,omitempty"`
+	RetryPolicy *RetryPolicy  `json:"retryPolicy,omitempty"`
+}
+
+// LabelSelector TaskRunnerのラベルに対する条件の一覧
+// すべての条件に一致するTaskRunnerが実行対象となる
+type LabelSelector []LabelRequirement
+
+// LabelRequirement TaskRunnerのラベルに対する条件
+// OperatorにはLabelOp〜の値が入る。LabelOpEquals,LabelOpNotEqualsはValuesに値を1つだけ指定する
+// LabelOpExists,LabelOpNotExistsはValuesを指定しない
+type LabelRequirement struct {
+	Key      string   `json:"key"`
+	Operator string   `json:"operator"`
+	Values   []string `json:"values,omitempty"`
+}
+
+const (
+	// LabelOpEquals ラベルの値が指定した値と等しい
+	LabelOpEquals string = "="
+	// LabelOpNotEquals ラベルの値が指定した値と異なるか、ラベルがない
+	LabelOpNotEquals string = "!="
+	// LabelOpIn ラベルの値が指定した値のどれかと等しい
+	LabelOpIn string = "in"
+	// LabelOpNotIn ラベルの値が指定した値のどれとも異なるか、ラベルがない
+	LabelOpNotIn string = "notin"
+	// LabelOpExists ラベルがある
+	LabelOpExists string = "exists"
+	// LabelOpNotExists ラベルがない
+	LabelOpNotExists string = "!exists"
+)
+
+// RetryPolicy タスクの再試行方針
+// タスクが失敗した場合や、タスクを実行していたTaskRunnerと通信できなくなった場合に別のTaskRunnerで再試行する
+// MaxAttempts 最大試行回数。0または1の場合は再試行しない
+// BackoffSec 再試行までの待機秒数。再試行のたびに2倍になる
+// MaxBackoffSec 待機秒数の上限。0の場合は上限なし
+type RetryPolicy struct {
+	MaxAttempts   int     `json:"maxAttempts"`
+	BackoffSec    float64 `json:"backoffSec"`
+	MaxBackoffSec float64 `json:"maxBackoffSec"`
 }
 
 // JobStartResponse コーディネーターサーバーへジョブ開始リクエストを行った時のレスポンス
@@ -52,18 +214,197 @@ type JobStartResponse struct {
 	ID string `json:"id"`
 }
 
+// JobCancelResponse コーディネーターサーバーへジョブキャンセルを行った時のレスポンス
+// Cancelledにはキャンセルを指示できた実行中のタスクと開始されなくなった未開始のタスク、AlreadyFinishedにはすでに終了していたタスク、
+// Failedには再試行してもTaskRunnerへキャンセルを指示できなかったタスクが入る
+type JobCancelResponse struct {
+	Cancelled       []JobCancelTask `json:"cancelled"`
+	AlreadyFinished []JobCancelTask `json:"alreadyFinished"`
+	Failed          []JobCancelTask `json:"failed"`
+}
+
+// JobCancelTask ジョブキャンセル時のタスクごとの結果
+// IndexはJobStartRequest.Tasksでの位置、IDはJobTaskRequestのID、TaskIDはTaskRunnerで開始したタスクのIDを表す
+// Errorにはキャンセルの指示に失敗した原因が入る
+type JobCancelTask struct {
+	Index  int    `json:"index"`
+	ID     string `json:"id,omitempty"`
+	TaskID string `json:"taskID,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
 // JobStatusResponse コーディネーターサーバーへジョブ状態取得を行った時のレスポンス
+// StateにはJobState〜の値、Transitionsにはこれまでの状態遷移が入る。Busyはジョブが終了していない間trueとなる
+// TaskStatusesにはCoordinatorが最後に取得できた各タスクの状態が入る
+// TaskErrorsには実行を完了できずに終了したタスクが入る
+// TasksにはJobStartRequestのTasksと同じ並びで各タスクの試行履歴が入る
+// Progressには各タスクの進捗を平均した0から1までのジョブ全体の進捗が入る
 type JobStatusResponse struct {
+	State        string                `json:"state"`
+	Progress     float64               `json:"progress"`
+	Transitions  []JobStateTransition  `json:"transitions"`
 	Busy         bool                  `json:"busy"`
 	TaskStatuses *[]TaskStatusResponse `json:"taskStatuses"`
+	TaskErrors   []JobTaskError        `json:"taskErrors,omitempty"`
+	Tasks        []JobTaskStatus       `json:"tasks"`
+}
+
+const (
+	// JobStatePending ジョブの実行開始を待っている
+	JobStatePending string = "Pending"
+	// JobStateRunning ジョブ内のタスクを実行中
+	JobStateRunning string = "Running"
+	// JobStateWaitingForRunner 実行中のタスクがなく、TaskRunnerへの割り当てを待っている
+	JobStateWaitingForRunner string = "WaitingForRunner"
+	// JobStateSucceeded 全タスクが成功して終了
+	JobStateSucceeded string = "Succeeded"
+	// JobStateFailed 成功したタスクがなく終了
+	JobStateFailed string = "Failed"
+	// JobStatePartiallyFailed 一部のタスクが成功しなかった
+	JobStatePartiallyFailed string = "PartiallyFailed"
+	// JobStateCancelled キャンセルにより終了
+	JobStateCancelled string = "Cancelled"
+	// JobStateTimedOut 制限時間を過ぎたため終了
+	JobStateTimedOut string = "TimedOut"
+)
+
+// JobStateTransition ジョブの状態遷移
+type JobStateTransition struct {
+	State string    `json:"state"`
+	Time  time.Time `json:"time"`
+}
+
+// JobTaskStatus ジョブ内のタスクの状態
+// StateにはTaskState〜の値が入る
+// LastStatusにはCoordinatorがTaskRunnerから最後に取得できたタスクの状態が入る
+// StatusUpdatedAt,StatusAgeSecにはLastStatusを取得した時刻と取得してからの経過秒数が入る
+// LastErrorにはタスクの状態取得で最後に発生したエラーが入る。その後取得に成功した場合は空となる
+// Progressには0から1までのタスクの進捗が入る。終了したタスクは1、実行中のタスクは最後に取得できた進捗となる
+type JobTaskStatus struct {
+	Index           int                 `json:"index"`
+	ID              string              `json:"id,omitempty"`
+	ProcName        string              `json:"procName"`
+	DependsOn       []string            `json:"dependsOn,omitempty"`
+	State           string              `json:"state"`
+	Attempts        []TaskAttempt       `json:"attempts"`
+	LastStatus      *TaskStatusResponse `json:"lastStatus,omitempty"`
+	StatusUpdatedAt *time.Time          `json:"statusUpdatedAt,omitempty"`
+	StatusAgeSec    float64             `json:"statusAgeSec"`
+	LastError       string              `json:"lastError,omitempty"`
+	Progress        float64             `json:"progress"`
+}
+
+const (
+	// TaskStateBlocked 依存先タスクの完了を待っている
+	TaskStateBlocked string = "Blocked"
+	// TaskStatePending TaskRunnerへの割り当てを待っている
+	TaskStatePending string = "Pending"
+	// TaskStateRunning TaskRunnerで実行中
+	TaskStateRunning string = "Running"
+	// TaskStateSucceeded 成功して終了
+	TaskStateSucceeded string = "Succeeded"
+	// TaskStateFailed 失敗して終了
+	TaskStateFailed string = "Failed"
+	// TaskStateSkipped 依存先タスクが成功しなかったため実行されずに終了
+	TaskStateSkipped string = "Skipped"
+	// TaskStateCancelled ジョブのキャンセルかTaskRunnerへのキャンセル指示により終了
+	TaskStateCancelled string = "Cancelled"
+	// TaskStateTimedOut タスクかジョブの制限時間を過ぎたため終了
+	TaskStateTimedOut string = "TimedOut"
+)
+
+// TaskAttempt タスクの1回分の試行結果
+// StatusにはTaskStatusResponseのStatusかAttemptStatusRunnerLostが入る
+type TaskAttempt struct {
+	TaskID     string     `json:"taskID"`
+	RunnerAddr string     `json:"runnerAddr"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// AttemptStatusRunnerLost タスクを実行していたTaskRunnerと通信できなくなった時にTaskAttemptのStatusで返される値
+const AttemptStatusRunnerLost string = "RunnerLost"
+
+// TaskErrorUnresolvedParams パラメータ内のプレースホルダが参照する結果値が存在しない時にJobTaskErrorのReasonで返される値
+const TaskErrorUnresolvedParams string = "UnresolvedParams"
+
+// JobTaskError ジョブ内で実行を完了できずに終了したタスクの情報
+// IndexはJobStartRequestのTasks内の位置を表す
+// ReasonにはTaskStartErrorの拒否理由、AttemptStatusRunnerLost、TaskErrorUnresolvedParamsのいずれかが入る
+type JobTaskError struct {
+	Index    int    `json:"index"`
+	ProcName string `json:"procName"`
+	Reason   string `json:"reason"`
+	Error    string `json:"error"`
+}
+
+// TaskRunnerStatsResponse TaskRunnerに負荷状況の取得を行った時のレスポンス
+type TaskRunnerStatsResponse struct {
+	ActiveTaskNum uint `json:"activeTaskNum"`
+	TaskNumMax    uint `json:"taskNumMax"`
 }
 
 // RunnerListResponse コーディネーターサーバーへタスクランナーの一覧取得を行った時のレスポンス
+// Schedulerにはタスクの割り当てに使用しているスケジューラー名が入る
+// StatusesにはRunnersと同じ並びで各TaskRunnerの状態が入る
 type RunnerListResponse struct {
-	Runners []string `json:"runners"`
+	Runners   []string       `json:"runners"`
+	Statuses  []RunnerStatus `json:"statuses"`
+	Scheduler string         `json:"scheduler"`
 }
 
+// RunnerStatus コーディネーターサーバーに接続しているTaskRunnerの状態
+// StateにはRunnerState〜の値が入る
+// ConnectedAtには接続した時刻、LastHealthyAtには生存通知を受け取るか生存確認に成功した最後の時刻が入る
+// HealthCheckFailuresには生存確認が連続で失敗した回数が入る
+// Version,Procs,Labels,ActiveTaskNum,TaskNumMaxにはTaskRunnerから最後に取得した情報が入る。ActiveTaskNumにはCoordinatorが割り当てたタスク数が反映される
+// TasksにはCoordinatorがこのTaskRunnerで実行中として監視しているタスクが入る
+type RunnerStatus struct {
+	Address             string            `json:"address"`
+	State               string            `json:"state"`
+	ConnectedAt         time.Time         `json:"connectedAt"`
+	LastHealthyAt       time.Time         `json:"lastHealthyAt"`
+	HealthCheckFailures int               `json:"healthCheckFailures"`
+	Version             string            `json:"version"`
+	Procs               []string          `json:"procs"`
+	Labels              map[string]string `json:"labels,omitempty"`
+	ActiveTaskNum       uint              `json:"activeTaskNum"`
+	TaskNumMax          uint              `json:"taskNumMax"`
+	Tasks               []RunnerTask      `json:"tasks"`
+}
+
+// RunnerTask TaskRunnerで実行中のタスク
+// TaskIndexはジョブ開始リクエストのTasks内の位置、TaskIDはTaskRunnerが発行したタスクIDを表す
+type RunnerTask struct {
+	JobID     string `json:"jobID"`
+	TaskIndex int    `json:"taskIndex"`
+	TaskID    string `json:"taskID"`
+}
+
+const (
+	// RunnerStateActive タスクの割り当て対象となっている
+	RunnerStateActive string = "Active"
+	// RunnerStateCordoned 新しいタスクを割り当てない
+	RunnerStateCordoned string = "Cordoned"
+	// RunnerStateDraining 新しいタスクを割り当てず、実行中のタスクが終了したら接続を解除する
+	RunnerStateDraining string = "Draining"
+	// RunnerStateDrained 退避が完了して接続が解除された。接続し直すかUncordonするまで登録を受け付けない
+	RunnerStateDrained string = "Drained"
+)
+
 // JobListResponse コーディネーターサーバーへジョブの一覧取得を行った時のレスポンス
+// JobsにはジョブID、SummariesにはJobsと同じ並びで各ジョブの状態が入る
 type JobListResponse struct {
-	Jobs []string `json:"jobs"`
+	Jobs      []string     `json:"jobs"`
+	Summaries []JobSummary `json:"summaries"`
+}
+
+// JobSummary ジョブ一覧取得で返されるジョブの状態
+// UpdatedAtには最後に状態が遷移した時刻が入る
+type JobSummary struct {
+	ID        string    `json:"id"`
+	State     string    `json:"state"`
+	UpdatedAt time.Time `json:"updatedAt"`
 }
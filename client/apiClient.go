@@ -0,0 +1,135 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/y-akahori-ramen/gojobcoordinatortest"
+)
+
+// apiClient JSONでやり取りするAPIを呼び出すクライアント
+// CoordinatorとTaskRunnerのクライアントが共通して使用する
+type apiClient struct {
+	baseURL string
+	Options
+}
+
+// newAPIClient 呼び出し先のURLを指定してapiClientを作成する (例)http://localhost:8080
+func newAPIClient(baseURL string, options Options) *apiClient {
+	return &apiClient{baseURL: strings.TrimSuffix(baseURL, "/"), Options: options}
+}
+
+// Get pathへGETし、応答をdstへ読み込む。dstがnilの場合は応答を読み込まない
+func (c *apiClient) Get(ctx context.Context, path string, dst interface{}) error {
+	return c.do(ctx, http.MethodGet, path, nil, dst, true)
+}
+
+// Post pathへbodyをJSONでPOSTし、応答をdstへ読み込む。bodyがnilの場合はBodyを送らない
+// 二重に処理される可能性があるため再試行しない
+func (c *apiClient) Post(ctx context.Context, path string, body, dst interface{}) error {
+	return c.do(ctx, http.MethodPost, path, body, dst, false)
+}
+
+// PostIdempotent 何度送っても結果が変わらないリクエストをPOSTする。失敗した場合は設定に従い再試行する
+func (c *apiClient) PostIdempotent(ctx context.Context, path string, body, dst interface{}) error {
+	return c.do(ctx, http.MethodPost, path, body, dst, true)
+}
+
+// Delete pathへDELETEし、応答をdstへ読み込む
+func (c *apiClient) Delete(ctx context.Context, path string, dst interface{}) error {
+	return c.do(ctx, http.MethodDelete, path, nil, dst, true)
+}
+
+func (c *apiClient) do(ctx context.Context, method, path string, body, dst interface{}, retryable bool) error {
+	retryNum := 0
+	if retryable {
+		retryNum = c.RetryNum
+	}
+	retryInterval := c.RetryInterval
+	if retryInterval <= 0 {
+		retryInterval = DefaultRetryInterval
+	}
+
+	var err error
+	for i := 0; i <= retryNum; i++ {
+		if i > 0 {
+			timer := time.NewTimer(retryInterval)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			}
+		}
+
+		err = c.doOnce(ctx, method, path, body, dst)
+		if err == nil || !isRetryableAPIError(ctx, err) {
+			return err
+		}
+	}
+	return err
+}
+
+// isRetryableAPIError 再試行で解消する可能性のあるエラーかを調べる
+// 呼び出し元のcontextが終了した場合と、5xx以外の応答は再試行しない
+func isRetryableAPIError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= http.StatusInternalServerError
+	}
+	return true
+}
+
+func (c *apiClient) doOnce(ctx context.Context, method, path string, body, dst interface{}) error {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	url := fmt.Sprint(c.baseURL, path)
+	var req *http.Request
+	var err error
+	if body != nil {
+		req, err = gojobcoordinatortest.NewJSONRequest(method, url, body)
+		if req != nil {
+			req = req.WithContext(ctx)
+		}
+	} else {
+		req, err = http.NewRequestWithContext(ctx, method, url, nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(res.Body)
+		return &APIError{Method: method, URL: url, StatusCode: res.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	if dst == nil {
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(dst); err != nil {
+		return fmt.Errorf("%v %v の応答の解析に失敗しました:%s", method, url, err.Error())
+	}
+	return nil
+}
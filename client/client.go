@@ -0,0 +1,68 @@
+// Package client CoordinatorとTaskRunnerのAPIを呼び出すクライアント
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Options クライアントの設定項目
+// HTTPClient リクエストに使用するHTTPクライアント。nilの場合はhttp.DefaultClientを使用する。
+// Timeout 1回のリクエストの制限時間。0の場合は呼び出し元のcontext以外で制限しない。
+// RetryNum 通信エラーか5xxの応答だった場合に再試行する回数。何度送っても結果が変わらないリクエストのみ再試行する。
+// RetryInterval 再試行までの待機時間。0の場合はDefaultRetryIntervalを使用する。
+type Options struct {
+	HTTPClient    *http.Client
+	Timeout       time.Duration
+	RetryNum      int
+	RetryInterval time.Duration
+}
+
+// DefaultRetryInterval OptionsのRetryIntervalの既定値
+const DefaultRetryInterval = time.Second
+
+var (
+	// ErrBadRequest リクエストの内容が不正なため拒否された時のエラー
+	ErrBadRequest = errors.New("リクエストが不正です")
+	// ErrNotFound 指定した対象が存在しない時のエラー
+	ErrNotFound = errors.New("対象が存在しません")
+	// ErrConflict 対象の状態によりリクエストが受け付けられなかった時のエラー
+	ErrConflict = errors.New("対象の状態によりリクエストを受け付けられません")
+	// ErrServer サーバー側でエラーが発生した時のエラー
+	ErrServer = errors.New("サーバーでエラーが発生しました")
+)
+
+// APIError APIが200 OK以外の応答を返した時のエラー
+// Messageには応答のBodyが入る
+// errors.IsでStatusCodeに対応するErr〜のエラーと一致する。Errが指定されている場合はErrとも一致する
+type APIError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Message    string
+	Err        error
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%v %v が失敗しました StatusCode:%v %v", e.Method, e.URL, e.StatusCode, e.Message)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrServer:
+		return e.StatusCode >= http.StatusInternalServerError
+	}
+	return false
+}
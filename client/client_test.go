@@ -0,0 +1,152 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/y-akahori-ramen/gojobcoordinatortest"
+	"github.com/y-akahori-ramen/gojobcoordinatortest/client"
+)
+
+type testEchoParams struct {
+	Value string `json:"value"`
+}
+
+var testEchoProc = gojobcoordinatortest.NewTypedProc[testEchoParams, testEchoParams]("Echo")
+
+// newTestServers テスト用のTaskRunnerとCoordinatorのサーバーを起動し、TaskRunnerを接続する
+func newTestServers(t *testing.T, ctx context.Context) (*httptest.Server, *httptest.Server) {
+	runner := gojobcoordinatortest.NewTaskRunner(gojobcoordinatortest.TaskRunnerConfig{TaskNumMax: 2})
+	err := gojobcoordinatortest.AddTypedTask(runner, testEchoProc, func(ctx context.Context, taskID string, logger *log.Logger, params testEchoParams) (testEchoParams, error) {
+		return params, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runnerServer := gojobcoordinatortest.NewTaskRunnerServer(runner)
+	go runnerServer.Run(ctx)
+	runnerHTTPServer := httptest.NewServer(runnerServer.NewHTTPHandler())
+	t.Cleanup(runnerHTTPServer.Close)
+
+	codHTTPServer := httptest.NewUnstartedServer(nil)
+	cod := gojobcoordinatortest.NewCoordinator(gojobcoordinatortest.CoordinatorConfig{
+		CallbackBaseURL: "http://" + codHTTPServer.Listener.Addr().String(), RunnerClientFactory: client.NewRunnerClientFactory(client.Options{}),
+	})
+	codServer := gojobcoordinatortest.NewCoordinatorServer(cod)
+	go codServer.Run(ctx)
+	codHTTPServer.Config.Handler = codServer.NewHTTPHandler()
+	codHTTPServer.Start()
+	t.Cleanup(codHTTPServer.Close)
+
+	return runnerHTTPServer, codHTTPServer
+}
+
+func TestCoordinatorClient(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runnerServer, codServer := newTestServers(t, ctx)
+
+	c := client.NewCoordinatorClient(codServer.URL, client.Options{Timeout: time.Second * 5})
+	if err := c.Connect(ctx, runnerServer.URL); err != nil {
+		t.Fatal(err)
+	}
+	runners, err := c.Runners(ctx)
+	if err != nil || len(runners.Runners) != 1 {
+		t.Fatalf("unexpected runners %v %v", runners, err)
+	}
+
+	taskReq, err := testEchoProc.NewRequest(testEchoParams{Value: "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	startResp, err := c.Start(ctx, gojobcoordinatortest.JobStartRequest{Tasks: []gojobcoordinatortest.JobTaskRequest{{TaskStartRequest: taskReq}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitCtx, waitCancel := context.WithTimeout(ctx, time.Second*10)
+	defer waitCancel()
+	status, err := client.WaitForJob(waitCtx, c, startResp.ID, time.Millisecond*100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != gojobcoordinatortest.JobStateSucceeded {
+		t.Fatalf("unexpected state %v", status.State)
+	}
+	result, err := testEchoProc.DecodeResult((*status.TaskStatuses)[0])
+	if err != nil || result.Value != "hello" {
+		t.Fatalf("unexpected result %v %v", result, err)
+	}
+
+	if err := c.DeleteJob(ctx, startResp.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// 存在しないジョブはCoordinatorのエラーとAPIのエラーの両方に一致する
+	_, err = c.Status(ctx, startResp.ID)
+	if !errors.Is(err, gojobcoordinatortest.ErrJobNotFound) || !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// 不正なジョブは拒否される
+	taskReq.ProcName = "Unknown"
+	_, err = c.Start(ctx, gojobcoordinatortest.JobStartRequest{Tasks: []gojobcoordinatortest.JobTaskRequest{{TaskStartRequest: taskReq, DependsOn: []string{"Missing"}}}})
+	if !errors.Is(err, client.ErrBadRequest) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestRunnerClient(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runnerServer, _ := newTestServers(t, ctx)
+
+	c := client.NewRunnerClient(runnerServer.URL, client.Options{})
+	info, err := c.Info(ctx)
+	if err != nil || len(info.Procs) != 1 {
+		t.Fatalf("unexpected info %v %v", info, err)
+	}
+
+	// タスク開始の拒否理由はTaskStartErrorとして返される
+	_, err = c.Start(ctx, gojobcoordinatortest.TaskStartRequest{ProcName: "Unknown"})
+	var startErr *gojobcoordinatortest.TaskStartError
+	if !errors.As(err, &startErr) || startErr.Reason != gojobcoordinatortest.TaskStartRejectUnknownProc {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	_, err = c.Status(ctx, "Unknown")
+	if !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestClientRetry(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) < 3 {
+			http.Error(rw, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		rw.Write([]byte(`{"activeTaskNum":1,"taskNumMax":2}`))
+	}))
+	defer server.Close()
+
+	options := client.Options{RetryNum: 2, RetryInterval: time.Millisecond * 10}
+	stats, err := client.NewRunnerClient(server.URL, options).Stats(context.Background())
+	if err != nil || stats.TaskNumMax != 2 || atomic.LoadInt32(&count) != 3 {
+		t.Fatalf("unexpected stats %v %v count:%v", stats, err, count)
+	}
+
+	// 二重に処理される可能性のあるリクエストは再試行しない
+	atomic.StoreInt32(&count, 0)
+	_, err = client.NewRunnerClient(server.URL, options).Start(context.Background(), gojobcoordinatortest.TaskStartRequest{ProcName: "Echo"})
+	if !errors.Is(err, client.ErrServer) || atomic.LoadInt32(&count) != 1 {
+		t.Fatalf("unexpected error %v count:%v", err, count)
+	}
+}
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/y-akahori-ramen/gojobcoordinatortest"
+)
+
+// CoordinatorClient CoordinatorのAPIを呼び出すクライアント
+// ジョブを指定するAPIで対象のジョブが存在しない場合、エラーはgojobcoordinatortest.ErrJobNotFoundと一致する
+type CoordinatorClient struct {
+	api *apiClient
+}
+
+// NewCoordinatorClient CoordinatorのURLを指定してCoordinatorClientを作成する (例)http://localhost:8080
+func NewCoordinatorClient(baseURL string, options Options) *CoordinatorClient {
+	return &CoordinatorClient{api: newAPIClient(baseURL, options)}
+}
+
+// Start ジョブを開始する
+// 二重に開始される可能性があるため再試行しない
+func (c *CoordinatorClient) Start(ctx context.Context, req gojobcoordinatortest.JobStartRequest) (gojobcoordinatortest.JobStartResponse, error) {
+	var response gojobcoordinatortest.JobStartResponse
+	err := c.api.Post(ctx, "/start", req, &response)
+	return response, err
+}
+
+// Cancel ジョブをキャンセルし、タスクごとのキャンセル結果を返す
+func (c *CoordinatorClient) Cancel(ctx context.Context, jobID string) (gojobcoordinatortest.JobCancelResponse, error) {
+	var response gojobcoordinatortest.JobCancelResponse
+	err := c.api.PostIdempotent(ctx, fmt.Sprint("/cancel/", jobID), nil, &response)
+	return response, withJobError(err)
+}
+
+// Status ジョブの状態を取得する
+func (c *CoordinatorClient) Status(ctx context.Context, jobID string) (gojobcoordinatortest.JobStatusResponse, error) {
+	var response gojobcoordinatortest.JobStatusResponse
+	err := c.api.Get(ctx, fmt.Sprint("/status/", jobID), &response)
+	return response, withJobError(err)
+}
+
+// Jobs ジョブの一覧を取得する
+func (c *CoordinatorClient) Jobs(ctx context.Context) (gojobcoordinatortest.JobListResponse, error) {
+	var response gojobcoordinatortest.JobListResponse
+	err := c.api.Get(ctx, "/jobs", &response)
+	return response, err
+}
+
+// DeleteJob 終了したジョブを削除する
+// 終了していないジョブを指定した場合、エラーはgojobcoordinatortest.ErrJobNotFinishedと一致する
+func (c *CoordinatorClient) DeleteJob(ctx context.Context, jobID string) error {
+	return withJobError(c.api.Delete(ctx, fmt.Sprint("/jobs/", jobID), nil))
+}
+
+// Runners 接続しているTaskRunnerの一覧を取得する
+func (c *CoordinatorClient) Runners(ctx context.Context) (gojobcoordinatortest.RunnerListResponse, error) {
+	var response gojobcoordinatortest.RunnerListResponse
+	err := c.api.Get(ctx, "/runners", &response)
+	return response, err
+}
+
+// Connect TaskRunnerを接続する
+// 接続済みの場合は失敗するため再試行しない
+func (c *CoordinatorClient) Connect(ctx context.Context, runnerAddr string) error {
+	return c.api.Post(ctx, "/connect", gojobcoordinatortest.TaskRunnerConnectionRequest{Address: runnerAddr}, nil)
+}
+
+// Disconnect TaskRunnerの接続を解除する
+func (c *CoordinatorClient) Disconnect(ctx context.Context, runnerAddr string) error {
+	return c.api.PostIdempotent(ctx, "/disconnect", gojobcoordinatortest.TaskRunnerConnectionRequest{Address: runnerAddr}, nil)
+}
+
+// Cordon TaskRunnerへの新しいタスクの割り当てを停止する
+func (c *CoordinatorClient) Cordon(ctx context.Context, runnerAddr string) error {
+	return c.api.PostIdempotent(ctx, "/cordon", gojobcoordinatortest.TaskRunnerConnectionRequest{Address: runnerAddr}, nil)
+}
+
+// Uncordon TaskRunnerへのタスクの割り当てを再開する
+func (c *CoordinatorClient) Uncordon(ctx context.Context, runnerAddr string) error {
+	return c.api.PostIdempotent(ctx, "/uncordon", gojobcoordinatortest.TaskRunnerConnectionRequest{Address: runnerAddr}, nil)
+}
+
+// Drain TaskRunnerへの割り当てを停止し、実行中のタスクが終了したら接続を解除する
+func (c *CoordinatorClient) Drain(ctx context.Context, runnerAddr string) error {
+	return c.api.PostIdempotent(ctx, "/drain", gojobcoordinatortest.TaskRunnerConnectionRequest{Address: runnerAddr}, nil)
+}
+
+// withJobError ジョブを指定したAPIのエラーに、応答に対応するCoordinatorのエラーを設定する
+func withJobError(err error) error {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusNotFound:
+			apiErr.Err = gojobcoordinatortest.ErrJobNotFound
+		case http.StatusConflict:
+			apiErr.Err = gojobcoordinatortest.ErrJobNotFinished
+		}
+	}
+	return err
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/y-akahori-ramen/gojobcoordinatortest"
+)
+
+// DefaultRunnerRequestTimeout NewRunnerClientFactoryで作成したクライアントの1回のリクエストの制限時間の既定値
+const DefaultRunnerRequestTimeout = time.Second * 30
+
+// RunnerClient TaskRunnerのAPIを呼び出すクライアント
+// gojobcoordinatortest.TaskRunnerClientを実装しており、CoordinatorもTaskRunnerとの通信に使用する
+type RunnerClient struct {
+	api *apiClient
+}
+
+// NewRunnerClient TaskRunnerのアドレスを指定してRunnerClientを作成する (例)http://localhost:8081
+func NewRunnerClient(addr string, options Options) *RunnerClient {
+	return &RunnerClient{api: newAPIClient(addr, options)}
+}
+
+// NewRunnerClientFactory CoordinatorConfigのRunnerClientFactoryに指定する、RunnerClientの作成関数を作成する
+// options.Timeoutが0の場合はDefaultRunnerRequestTimeoutを使用する
+func NewRunnerClientFactory(options Options) gojobcoordinatortest.RunnerClientFactory {
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultRunnerRequestTimeout
+	}
+	return func(addr string) gojobcoordinatortest.TaskRunnerClient {
+		return NewRunnerClient(addr, options)
+	}
+}
+
+// Address 呼び出し先のTaskRunnerのアドレスを取得する
+func (c *RunnerClient) Address() string {
+	return c.api.baseURL
+}
+
+// Start タスクを開始する
+// TaskRunnerがタスク開始を拒否した場合は拒否理由を持つ*TaskStartErrorを返す
+// 二重に開始される可能性があるため再試行しない
+func (c *RunnerClient) Start(ctx context.Context, req gojobcoordinatortest.TaskStartRequest) (gojobcoordinatortest.TaskStartResponse, error) {
+	var response gojobcoordinatortest.TaskStartResponse
+	err := c.api.Post(ctx, "/start", req, &response)
+
+	// 拒否理由が返されていればそれを返す
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		var startErr gojobcoordinatortest.TaskStartError
+		if json.Unmarshal([]byte(apiErr.Message), &startErr) == nil && startErr.Reason != "" {
+			return response, &startErr
+		}
+	}
+	return response, err
+}
+
+// Cancel タスクのキャンセルをリクエストする
+func (c *RunnerClient) Cancel(ctx context.Context, taskID string) error {
+	return c.api.PostIdempotent(ctx, fmt.Sprint("/cancel/", taskID), nil, nil)
+}
+
+// Status タスクの状態を取得する
+func (c *RunnerClient) Status(ctx context.Context, taskID string) (gojobcoordinatortest.TaskStatusResponse, error) {
+	var response gojobcoordinatortest.TaskStatusResponse
+	err := c.api.Get(ctx, fmt.Sprint("/status/", taskID), &response)
+	return response, err
+}
+
+// Delete 終了したタスクを削除する
+func (c *RunnerClient) Delete(ctx context.Context, taskID string) error {
+	return c.api.PostIdempotent(ctx, fmt.Sprint("/delete/", taskID), nil, nil)
+}
+
+// Alive TaskRunnerの生存を確認する
+func (c *RunnerClient) Alive(ctx context.Context) error {
+	return c.api.Get(ctx, "/alive", nil)
+}
+
+// Tasks 管理対象のタスクID一覧を取得する
+func (c *RunnerClient) Tasks(ctx context.Context) (gojobcoordinatortest.TaskListResponse, error) {
+	var response gojobcoordinatortest.TaskListResponse
+	err := c.api.Get(ctx, "/tasks", &response)
+	return response, err
+}
+
+// Stats 負荷状況を取得する
+func (c *RunnerClient) Stats(ctx context.Context) (gojobcoordinatortest.TaskRunnerStatsResponse, error) {
+	var response gojobcoordinatortest.TaskRunnerStatsResponse
+	err := c.api.Get(ctx, "/stats", &response)
+	return response, err
+}
+
+// Procs 実行可能な処理名の一覧を取得する
+func (c *RunnerClient) Procs(ctx context.Context) (gojobcoordinatortest.TaskProcListResponse, error) {
+	var response gojobcoordinatortest.TaskProcListResponse
+	err := c.api.Get(ctx, "/procs", &response)
+	return response, err
+}
+
+// Labels ラベルを取得する
+func (c *RunnerClient) Labels(ctx context.Context) (gojobcoordinatortest.TaskRunnerLabelsResponse, error) {
+	var response gojobcoordinatortest.TaskRunnerLabelsResponse
+	err := c.api.Get(ctx, "/labels", &response)
+	return response, err
+}
+
+// Schemas 処理名ごとのパラメータのスキーマを取得する
+func (c *RunnerClient) Schemas(ctx context.Context) (gojobcoordinatortest.TaskRunnerSchemasResponse, error) {
+	var response gojobcoordinatortest.TaskRunnerSchemasResponse
+	err := c.api.Get(ctx, "/schemas", &response)
+	return response, err
+}
+
+// Info 設定と負荷状況を取得する
+func (c *RunnerClient) Info(ctx context.Context) (gojobcoordinatortest.TaskRunnerInfoResponse, error) {
+	var response gojobcoordinatortest.TaskRunnerInfoResponse
+	err := c.api.Get(ctx, "/info", &response)
+	return response, err
+}
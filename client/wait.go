@@ -0,0 +1,43 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/y-akahori-ramen/gojobcoordinatortest"
+)
+
+// DefaultWaitInterval WaitForJobでジョブの状態を確認する間隔の既定値
+const DefaultWaitInterval = time.Second
+
+// WaitForJob ジョブが終了するまで待ち、終了時の状態を返す
+// intervalごとにジョブの状態を確認する。0の場合はDefaultWaitIntervalを使用する
+// 状態の取得に失敗した場合はそのエラーを、ctxが終了した場合は最後に取得できた状態とctxのエラーを返す
+func WaitForJob(ctx context.Context, c *CoordinatorClient, jobID string, interval time.Duration) (gojobcoordinatortest.JobStatusResponse, error) {
+	if interval <= 0 {
+		interval = DefaultWaitInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last gojobcoordinatortest.JobStatusResponse
+	for {
+		status, err := c.Status(ctx, jobID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return last, ctx.Err()
+			}
+			return last, err
+		}
+		last = status
+		if !status.Busy {
+			return status, nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return last, ctx.Err()
+		}
+	}
+}
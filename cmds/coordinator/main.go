@@ -8,13 +8,42 @@ import (
 	"net/http"
 
 	"github.com/y-akahori-ramen/gojobcoordinatortest"
+	"github.com/y-akahori-ramen/gojobcoordinatortest/client"
 )
 
 func main() {
 	var addr = flag.String("addr", "localhost:8080", "サーバーアドレス")
+	var jobStoreDir = flag.String("jobStoreDir", "", "ジョブ情報の保存先ディレクトリ。指定しない場合は保存しない")
+	var callbackBaseURL = flag.String("callbackBaseURL", "", "TaskRunnerからタスク完了通知を受け取るこのサーバーのURL (例)http://localhost:8080。指定しない場合はポーリングのみで完了を確認する")
+	var schedulerName = flag.String("scheduler", gojobcoordinatortest.SchedulerRoundRobin,
+		fmt.Sprintf("タスクの割り当て方法 %s|%s|%s", gojobcoordinatortest.SchedulerRoundRobin, gojobcoordinatortest.SchedulerLeastLoaded, gojobcoordinatortest.SchedulerRandom))
+	var jobRetention = flag.Duration("jobRetention", 0, "終了したジョブを保持する期間 (例)24h。指定しない場合は期間で削除しない")
+	var maxFinishedJobs = flag.Int("maxFinishedJobs", 0, "終了したジョブを保持する最大数。指定しない場合は数で削除しない")
 	flag.Parse()
 
-	cod := gojobcoordinatortest.NewCoordinator(gojobcoordinatortest.CoordinatorConfig{})
+	scheduler, err := gojobcoordinatortest.NewScheduler(*schedulerName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	config := gojobcoordinatortest.CoordinatorConfig{
+		CallbackBaseURL: *callbackBaseURL, Scheduler: scheduler, JobRetention: *jobRetention, MaxFinishedJobs: *maxFinishedJobs,
+		RunnerClientFactory: client.NewRunnerClientFactory(client.Options{}),
+	}
+	if *jobStoreDir != "" {
+		store, err := gojobcoordinatortest.NewFileJobStore(*jobStoreDir, gojobcoordinatortest.DefaultSnapshotInterval)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer store.Close()
+		config.Store = store
+	}
+
+	cod := gojobcoordinatortest.NewCoordinator(config)
+	if err := cod.LoadJobs(); err != nil {
+		log.Fatal(err)
+	}
+
 	server := gojobcoordinatortest.NewCoordinatorServer(cod)
 	fmt.Println("サーバー起動します:", *addr)
 
@@ -6,6 +6,12 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/y-akahori-ramen/gojobcoordinatortest"
 )
@@ -13,19 +19,78 @@ import (
 func main() {
 	var addr = flag.String("addr", "localhost:8000", "サーバーアドレス")
 	var maxTaskNum = flag.Uint("maxTaskNum", 2, "同時実行できる最大タスク数")
+	var coordinatorURL = flag.String("coordinator", "", "登録先のコーディネーターサーバーのURL (例)http://localhost:8080。指定しない場合は登録しない")
+	var advertiseURL = flag.String("advertiseURL", "", "コーディネーターサーバーからこのサーバーへアクセスする際のURL。指定しない場合はhttp://{addr}とする")
+	var heartbeatInterval = flag.Duration("heartbeatInterval", gojobcoordinatortest.DefaultHeartbeatInterval, "コーディネーターサーバーへ生存通知を送る間隔")
+	var drainTimeout = flag.Duration("drainTimeout", time.Minute*5, "停止時にコーディネーターサーバーへ退避を依頼し、実行中のタスクの終了を待つ最大時間。0の場合は退避を依頼しない")
+	var labelsFlag = flag.String("labels", "", "Coordinatorがタスクの割り当て先を選ぶ際に使用するラベル (例)os=linux,pool=batch")
 	flag.Parse()
 
-	runner := gojobcoordinatortest.NewTaskRunner(gojobcoordinatortest.TaskRunnerConfig{TaskNumMax: *maxTaskNum})
-	runner.AddFactory(ProcNameWait, newWaitTask)
-	runner.AddFactory(ProcNameEcho, newEchoTask)
+	labels, err := parseLabels(*labelsFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	runner := gojobcoordinatortest.NewTaskRunner(gojobcoordinatortest.TaskRunnerConfig{TaskNumMax: *maxTaskNum, Labels: labels})
+	if err := addSampleTasks(runner); err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	server := gojobcoordinatortest.NewTaskRunnerServer(runner)
-	router := server.NewHTTPHandler()
+	httpServer := &http.Server{Addr: *addr, Handler: server.NewHTTPHandler()}
+	// 退避中もタスクの完了を処理できるよう、登録の解除が終わるまでTaskRunnerは停止しない
+	serverCtx, stopServer := context.WithCancel(context.Background())
+	defer stopServer()
 	go func() {
-		server.Run(context.Background())
+		server.Run(serverCtx)
+	}()
+
+	var registration sync.WaitGroup
+	if *coordinatorURL != "" {
+		config := gojobcoordinatortest.TaskRunnerRegistrationConfig{CoordinatorURL: *coordinatorURL, Address: *advertiseURL, HeartbeatInterval: *heartbeatInterval, DrainTimeout: *drainTimeout}
+		if config.Address == "" {
+			config.Address = fmt.Sprint("http://", *addr)
+		}
+		registration.Add(1)
+		go func() {
+			defer registration.Done()
+			runner.RunRegistration(ctx, config)
+		}()
+	}
+
+	go func() {
+		<-ctx.Done()
+		// 登録を解除してからサーバーを停止する
+		registration.Wait()
+		stopServer()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
 	}()
 
 	fmt.Printf("サーバー起動します addr:%v 同時タスク実行数最大:%v\n", *addr, *maxTaskNum)
 
-	log.Fatal(http.ListenAndServe(*addr, router))
+	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
+
+// parseLabels key=value形式をカンマ区切りで並べた文字列をラベルとして解析する
+func parseLabels(str string) (map[string]string, error) {
+	labels := map[string]string{}
+	if str == "" {
+		return labels, nil
+	}
+
+	for _, pair := range strings.Split(str, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("ラベルの形式が不正です:%s", pair)
+		}
+		labels[kv[0]] = kv[1]
+	}
+	return labels, nil
 }
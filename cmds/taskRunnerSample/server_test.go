@@ -23,8 +23,7 @@ func (handler *testLogHandler) HandleLog(id string, p []byte) {
 
 func newServer(taskMaxNum int32) *gojobcoordinatortest.TaskRunnerServer {
 	runner := gojobcoordinatortest.NewTaskRunner(gojobcoordinatortest.TaskRunnerConfig{TaskNumMax: 2, Handler: &testLogHandler{}})
-	runner.AddFactory(ProcNameWait, newWaitTask)
-	runner.AddFactory(ProcNameEcho, newEchoTask)
+	addSampleTasks(runner)
 
 	server := gojobcoordinatortest.NewTaskRunnerServer(runner)
 	return server
@@ -52,6 +51,52 @@ func TestStartEchoTask(t *testing.T) {
 	}
 }
 
+func TestStartInvalidParams(t *testing.T) {
+	server := newServer(2)
+	router := server.NewHTTPHandler()
+	go server.Run(context.Background())
+
+	params := map[string]interface{}{
+		"Sec": "NotNumber",
+	}
+	reqestData := gojobcoordinatortest.TaskStartRequest{ProcName: ProcNameWait, Params: &params}
+
+	req, err := gojobcoordinatortest.NewJSONRequest(http.MethodPost, "/start", reqestData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, req)
+	if response.Code != http.StatusBadRequest {
+		t.Fatalf("%d != %d, want %d", response.Code, http.StatusBadRequest, http.StatusBadRequest)
+	}
+
+	var result gojobcoordinatortest.TaskStartError
+	err = gojobcoordinatortest.ReadJSONFromResponse(response.Result(), &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Reason != gojobcoordinatortest.TaskStartRejectInvalidParams {
+		t.Fatalf("%s != %s", result.Reason, gojobcoordinatortest.TaskStartRejectInvalidParams)
+	}
+}
+
+func TestWaitParamsRequireSec(t *testing.T) {
+	// スキーマとは別に、Validateでも未指定のSecを拒否する
+	if _, err := ProcWait.DecodeParams(&gojobcoordinatortest.TaskStartRequest{ProcName: ProcNameWait, Params: &map[string]interface{}{}}); err == nil {
+		t.Fatal("Secの指定がないパラメータが受け付けられました")
+	}
+
+	runner := gojobcoordinatortest.NewTaskRunner(gojobcoordinatortest.TaskRunnerConfig{TaskNumMax: 1})
+	if err := addSampleTasks(runner); err != nil {
+		t.Fatal(err)
+	}
+	if schema := runner.GetParamsSchemas()[ProcNameWait]; len(schema.Required) != 1 || schema.Required[0] != "Sec" {
+		t.Fatalf("unexpected schema %+v", schema)
+	}
+}
+
 func TestStartWaitTask(t *testing.T) {
 	server := newServer(2)
 	router := server.NewHTTPHandler()
@@ -222,7 +267,8 @@ func waitTaskComplete(t *testing.T, handler http.Handler, taskID string, wg *syn
 
 	req, err := http.NewRequest(http.MethodGet, fmt.Sprint("/status/", taskID), nil)
 	if err != nil {
-		t.Fatal(err)
+		t.Error(err)
+		return
 	}
 
 	for range ticker.C {
@@ -235,13 +281,15 @@ func waitTaskComplete(t *testing.T, handler http.Handler, taskID string, wg *syn
 			if err == nil {
 				t.Log(string(body))
 			}
-			t.Fatalf("%d != %d, want %d", response.Code, http.StatusOK, http.StatusOK)
+			t.Errorf("%d != %d, want %d", response.Code, http.StatusOK, http.StatusOK)
+			return
 		}
 
 		var result gojobcoordinatortest.TaskStatusResponse
 		err = gojobcoordinatortest.ReadJSONFromResponse(response.Result(), &result)
 		if err != nil {
-			t.Fatal(err)
+			t.Error(err)
+			return
 		}
 		if result.Status != gojobcoordinatortest.StatusBusy {
 			if result.ResultValues != nil {
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -17,80 +18,92 @@ const (
 	ProcNameEcho string = "Echo"
 )
 
-// 指定された値を出力するタスク
-type taskEcho struct {
-	value string
-}
-
-func (task *taskEcho) Run(ctx context.Context, taskID string, logger *log.Logger, done chan<- *gojobcoordinatortest.TaskResult) {
-	logger.Println("Echo:", task.value)
-	done <- &gojobcoordinatortest.TaskResult{ID: taskID, Success: true}
-}
+var (
+	// ProcWait ウェイトを実行するタスク処理
+	ProcWait = gojobcoordinatortest.NewTypedProc[waitParams, struct{}](ProcNameWait)
 
-func newEchoTask(req *gojobcoordinatortest.TaskStartRequest) (gojobcoordinatortest.Task, error) {
-	if req.ProcName != ProcNameEcho {
-		return nil, fmt.Errorf("処理名 %s が不正です", req.ProcName)
-	}
+	// ProcEcho 受け取った文字列を出力するタスク処理
+	ProcEcho = gojobcoordinatortest.NewTypedProc[echoParams, echoResult](ProcNameEcho)
+)
 
-	if req.Params == nil {
-		return nil, fmt.Errorf("%sに必要なパラメータValueが存在しません", req.ProcName)
+// addSampleTasks サンプルのタスク処理を登録する
+func addSampleTasks(runner *gojobcoordinatortest.TaskRunner) error {
+	// Secは未指定を判別するためポインタにしているが、スキーマ上は必須とする
+	waitSchema := ProcWait.ParamsSchema()
+	waitSchema.Required = append(waitSchema.Required, "Sec")
+	if err := gojobcoordinatortest.AddTypedTaskWithOptions(runner, ProcWait, runWait, gojobcoordinatortest.TaskFactoryOptions{ParamsSchema: waitSchema}); err != nil {
+		return err
 	}
+	return gojobcoordinatortest.AddTypedTask(runner, ProcEcho, runEcho)
+}
 
-	value, ok := (*req.Params)[string("Value")]
-
-	if !ok {
-		return nil, fmt.Errorf("%sに必要なパラメータValueが存在しません", req.ProcName)
-	}
+// echoParams 指定された値を出力するタスクのパラメータ
+type echoParams struct {
+	Value string `json:"Value"`
+}
 
-	valueStr, ok := value.(string)
-	if !ok {
-		return nil, fmt.Errorf("%sのパラメータValueは文字列で指定してください", req.ProcName)
+func (params *echoParams) Validate() error {
+	if params.Value == "" {
+		return errors.New("Valueを指定してください")
 	}
-
-	return &taskEcho{value: valueStr}, nil
+	return nil
 }
 
-// 指定された時間待機するタスク
-type taskWait struct {
-	waitSec float64
+// echoResult 指定された値を出力するタスクの結果
+type echoResult struct {
+	Value string `json:"Value"`
 }
 
-func (task *taskWait) Run(ctx context.Context, taskID string, logger *log.Logger, done chan<- *gojobcoordinatortest.TaskResult) {
-	duration := time.Duration(task.waitSec * (float64)(time.Second))
-	ticker := time.NewTicker(duration)
-	logger.Printf("[taskWait][%v]%v待機します", taskID, duration.String())
-	defer ticker.Stop()
-
-	select {
-	case <-ticker.C:
-		logger.Printf("[taskWait][%v]待機が完了しました", taskID)
-		done <- &gojobcoordinatortest.TaskResult{ID: taskID, Success: true}
-		return
-	case <-ctx.Done():
-		logger.Printf("[taskWait][%v]キャンセルが発生しました", taskID)
-		done <- &gojobcoordinatortest.TaskResult{ID: taskID, Success: false}
-		return
-	}
+// 指定された値を出力するタスク
+func runEcho(ctx context.Context, taskID string, logger *log.Logger, params echoParams) (echoResult, error) {
+	logger.Println("Echo:", params.Value)
+	return echoResult{Value: params.Value}, nil
 }
 
-func newWaitTask(req *gojobcoordinatortest.TaskStartRequest) (gojobcoordinatortest.Task, error) {
-	if req.ProcName != ProcNameWait {
-		return nil, fmt.Errorf("処理名 %s が不正です", req.ProcName)
-	}
+// waitParams 指定された時間待機するタスクのパラメータ
+type waitParams struct {
+	Sec *float64 `json:"Sec"`
+}
 
-	if req.Params == nil {
-		return nil, fmt.Errorf("%sに必要なパラメータSecが存在しません", req.ProcName)
+func (params *waitParams) Validate() error {
+	if params.Sec == nil {
+		return errors.New("Secを指定してください")
 	}
-
-	value, ok := (*req.Params)[string("Sec")]
-	if !ok {
-		return nil, fmt.Errorf("%sに必要なパラメータSecが存在しません", req.ProcName)
+	if *params.Sec < 0 {
+		return errors.New("Secは0以上の数値で指定してください")
 	}
+	return nil
+}
 
-	sec, ok := value.(float64)
-	if !ok {
-		return nil, fmt.Errorf("%sのパラメータSecは数値で指定してください", req.ProcName)
+// 指定された時間待機するタスク
+// 待機中にキャンセルされた場合や制限時間を過ぎた場合は、TaskRunnerがctxの状態からキャンセルか制限時間切れかを判定する
+func runWait(ctx context.Context, taskID string, logger *log.Logger, params waitParams) (struct{}, error) {
+	duration := time.Duration(*params.Sec * (float64)(time.Second))
+	timer := time.NewTimer(duration)
+	logger.Printf("[taskWait][%v]%v待機します", taskID, duration.String())
+	defer timer.Stop()
+
+	// 待機中は経過時間を進捗として報告する
+	progressTicker := time.NewTicker(waitProgressInterval)
+	defer progressTicker.Stop()
+	start := time.Now()
+	for {
+		select {
+		case <-timer.C:
+			logger.Printf("[taskWait][%v]待機が完了しました", taskID)
+			return struct{}{}, nil
+		case <-progressTicker.C:
+			elapsed := time.Since(start)
+			gojobcoordinatortest.ReportProgress(ctx, gojobcoordinatortest.TaskProgress{
+				Fraction: elapsed.Seconds() / duration.Seconds(),
+				Message:  fmt.Sprintf("%v/%v経過", elapsed.Round(time.Second), duration),
+			})
+		case <-ctx.Done():
+			logger.Printf("[taskWait][%v]待機を中断しました:%v", taskID, ctx.Err())
+			return struct{}{}, ctx.Err()
+		}
 	}
-
-	return &taskWait{waitSec: sec}, nil
 }
+
+// waitProgressInterval 待機するタスクが進捗を報告する間隔
+const waitProgressInterval = time.Second
@@ -1,13 +1,11 @@
 package gojobcoordinatortest
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
-	"net/http"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -17,20 +15,66 @@ import (
 
 // CoordinatorConfig コーディネータの設定項目
 // Handler ジョブのログ出力ハンドリング。不要な場合はnilを指定する。
+// Store ジョブ情報の永続化先。不要な場合はnilを指定する。
+// CallbackBaseURL TaskRunnerからタスク完了通知を受け取るこのCoordinatorのURL (例)http://localhost:8080
+// 空の場合は完了通知を使用せずポーリングのみでタスク完了を確認する。
+// Scheduler タスクを割り当てるTaskRunnerの選択戦略。nilの場合はRoundRobinSchedulerを使用する。
+// JobRetention 終了したジョブを保持する期間。経過したジョブは削除される。0の場合は期間で削除しない。
+// MaxFinishedJobs 終了したジョブを保持する最大数。超えた場合は終了した時刻が古いものから削除される。0の場合は数で削除しない。
+// RunnerTimeout TaskRunnerから生存通知が届かず生存確認にも失敗し続けた場合に接続を解除するまでの時間。0の場合はDefaultRunnerTimeoutを使用する。
+// RunnerClientFactory TaskRunnerのAPIを呼び出すクライアントの作成関数。nilの場合は再試行せず1回のリクエストを30秒で打ち切るクライアントを使用する。再試行などを設定する場合はclient.NewRunnerClientFactoryで作成したものを指定する。
 type CoordinatorConfig struct {
-	Handler LogHandler
+	Handler             LogHandler
+	Store               JobStore
+	CallbackBaseURL     string
+	Scheduler           Scheduler
+	JobRetention        time.Duration
+	MaxFinishedJobs     int
+	RunnerTimeout       time.Duration
+	RunnerClientFactory RunnerClientFactory
 }
 
+// DefaultRunnerTimeout CoordinatorConfigのRunnerTimeoutの既定値
+const DefaultRunnerTimeout = time.Second * 90
+
+// runnerDrainCheckInterval 退避中のTaskRunnerで実行中のタスクが終了したかを確認する間隔
+const runnerDrainCheckInterval = time.Second
+
+var (
+	// ErrJobNotFound 指定したIDのジョブが存在しない時のエラー
+	ErrJobNotFound = errors.New("ジョブが存在しません")
+	// ErrJobNotFinished 終了していないジョブを削除しようとした時のエラー
+	ErrJobNotFinished = errors.New("終了していないジョブは削除できません")
+	// ErrRunnerNotRegistered 登録されていないTaskRunnerから生存通知が届いた時のエラー
+	ErrRunnerNotRegistered = errors.New("TaskRunnerが登録されていません")
+	// ErrRunnerDrained 退避が完了したTaskRunnerから登録が届いた時のエラー
+	ErrRunnerDrained = errors.New("TaskRunnerは退避済みです")
+)
+
 // Coordinator TaskRunnerServerを管理してタスクを振り分ける
+// runnersChangedはタスクを割り当て可能なTaskRunnerが増えた時に閉じられ、新しいチャネルに置き換えられる
+// drainedRunnersには退避が完了して接続を解除したTaskRunnerのアドレスが入る。接続し直すかUncordonするまで登録を受け付けない
 type Coordinator struct {
 	CoordinatorConfig
-	jobs        sync.Map
-	runnerAddrs sync.Map
+	jobs               sync.Map
+	runnerAddrs        sync.Map
+	drainedRunners     sync.Map
+	runnersChangedLock sync.Mutex
+	runnersChanged     chan struct{}
 }
 
 // NewCoordinator Coordinatorの作成
 func NewCoordinator(config CoordinatorConfig) *Coordinator {
-	return &Coordinator{CoordinatorConfig: config}
+	if config.RunnerClientFactory == nil {
+		config.RunnerClientFactory = newDefaultRunnerClient
+	}
+	if config.Scheduler == nil {
+		config.Scheduler = NewRoundRobinScheduler()
+	}
+	if config.RunnerTimeout <= 0 {
+		config.RunnerTimeout = DefaultRunnerTimeout
+	}
+	return &Coordinator{CoordinatorConfig: config, runnersChanged: make(chan struct{})}
 }
 
 // Run Coordinatorの起動
@@ -40,15 +84,28 @@ func (cod *Coordinator) Run(ctx context.Context) {
 		select {
 		case <-ticker.C:
 			cod.removeDeadTaskRunners()
+			cod.collectFinishedJobs()
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
+// Start ジョブを開始する
+// リクエストの内容が不正な場合は*JobRequestErrorを返す
 func (cod *Coordinator) Start(req JobStartRequest) (JobStartResponse, error) {
 	resp := JobStartResponse{}
-	jobID, err := cod.newJob()
+	if err := cod.validateJobRequest(req); err != nil {
+		return resp, err
+	}
+	if req.TimeoutSec > 0 {
+		deadline := time.Now().Add(time.Duration(req.TimeoutSec * float64(time.Second)))
+		if req.Deadline == nil || deadline.Before(*req.Deadline) {
+			req.Deadline = &deadline
+		}
+	}
+
+	jobID, err := cod.newJob(req)
 	if err != nil {
 		return resp, err
 	}
@@ -58,21 +115,21 @@ func (cod *Coordinator) Start(req JobStartRequest) (JobStartResponse, error) {
 		return resp, err
 	}
 
-	go job.run(cod, &req)
+	go job.run(cod)
 
 	resp.ID = jobID
 	return resp, err
 }
 
-func (cod *Coordinator) Cancel(id string) error {
+// Cancel ジョブのキャンセルを行い、タスクごとのキャンセル結果を返す
+// 実行中のタスクへのキャンセルリクエストに失敗した場合は再試行する
+func (cod *Coordinator) Cancel(id string) (JobCancelResponse, error) {
 	job, err := cod.getJob(id)
 	if err != nil {
-		return err
+		return JobCancelResponse{}, err
 	}
 
-	job.cancel()
-
-	return nil
+	return job.cancel(cod), nil
 }
 
 func (cod *Coordinator) GetStatus(id string) (JobStatusResponse, error) {
@@ -84,21 +141,62 @@ func (cod *Coordinator) GetStatus(id string) (JobStatusResponse, error) {
 	return job.getStatus(), err
 }
 
+// DeleteJob 終了したジョブを削除する
+// 終了していないジョブを指定した場合はErrJobNotFinishedを返す
+func (cod *Coordinator) DeleteJob(id string) error {
+	job, err := cod.getJob(id)
+	if err != nil {
+		return err
+	}
+
+	state, _ := job.getState()
+	if !isJobStateFinished(state) {
+		return fmt.Errorf("%w:%v", ErrJobNotFinished, id)
+	}
+
+	return cod.removeJob(job)
+}
+
+// NotifyTaskDone TaskRunnerからのタスク完了通知を受け取る
+func (cod *Coordinator) NotifyTaskDone(jobID string, status TaskStatusResponse) error {
+	job, err := cod.getJob(jobID)
+	if err != nil {
+		return err
+	}
+
+	job.notifyTaskDone(status)
+	return nil
+}
+
 func (cod *Coordinator) Connect(req TaskRunnerConnectionRequest) error {
 	_, exist := cod.runnerAddrs.Load(req.Address)
 	if exist == true {
 		return errors.New(fmt.Sprint("すでに接続済みです:", req.Address))
 	}
 
+	if _, drained := cod.drainedRunners.LoadAndDelete(req.Address); drained {
+		log.Println("退避済みのTaskRunnerを接続し直します:", req.Address)
+	}
 	log.Println("TaskRunnerを接続しました:", req.Address)
-	cod.runnerAddrs.Store(req.Address, nil)
+	info := newRunnerInfo(req.Address)
+	cod.runnerAddrs.Store(req.Address, info)
+	if err := info.update(cod.runnerClient(req.Address)); err != nil {
+		log.Println("TaskRunnerの情報取得に失敗しました:", req.Address, err)
+	}
+	cod.notifyRunnersChanged()
 
 	return nil
 }
 
+// Disconnect TaskRunnerの接続を解除する
+// 退避が完了したTaskRunnerを指定した場合は退避済みの記録を削除し、再び登録を受け付ける
 func (cod *Coordinator) Disconnect(req TaskRunnerConnectionRequest) error {
 	_, exist := cod.runnerAddrs.Load(req.Address)
 	if exist == false {
+		if _, drained := cod.drainedRunners.LoadAndDelete(req.Address); drained {
+			log.Println("退避済みのTaskRunnerの記録を削除しました:", req.Address)
+			return nil
+		}
 		return errors.New(fmt.Sprint("接続されていません:", req.Address))
 	}
 
@@ -109,95 +207,385 @@ func (cod *Coordinator) Disconnect(req TaskRunnerConnectionRequest) error {
 	return nil
 }
 
+// Register TaskRunnerからの登録を受け付ける
+// 登録済みのTaskRunnerの場合は実行可能な処理名と負荷状況を更新する
+// 退避が完了したTaskRunnerの場合は登録せずにErrRunnerDrainedを返す
+func (cod *Coordinator) Register(req TaskRunnerRegisterRequest) error {
+	if _, drained := cod.drainedRunners.Load(req.Address); drained {
+		return fmt.Errorf("%w:%v", ErrRunnerDrained, req.Address)
+	}
+
+	value, exist := cod.runnerAddrs.LoadOrStore(req.Address, newRunnerInfo(req.Address))
+	info := value.(*runnerInfo)
+	info.setInfo(req.TaskRunnerInfoResponse)
+	info.touch()
+
+	if exist {
+		log.Println("TaskRunnerが再登録されました:", req.Address)
+	} else {
+		log.Println("TaskRunnerが登録されました:", req.Address)
+	}
+	cod.notifyRunnersChanged()
+	return nil
+}
+
+// Heartbeat TaskRunnerからの生存通知を受け取り、TaskRunnerの状態を返す
+// 退避が完了したTaskRunnerの場合はRunnerStateDrainedを返す。TaskRunnerはこれを受けて再登録を控える
+// 登録されていないTaskRunnerの場合はErrRunnerNotRegisteredを返す。TaskRunnerはこれを受けて再登録する
+func (cod *Coordinator) Heartbeat(req TaskRunnerHeartbeatRequest) (TaskRunnerHeartbeatResponse, error) {
+	value, exist := cod.runnerAddrs.Load(req.Address)
+	if !exist {
+		if _, drained := cod.drainedRunners.Load(req.Address); drained {
+			return TaskRunnerHeartbeatResponse{State: RunnerStateDrained}, nil
+		}
+		return TaskRunnerHeartbeatResponse{}, fmt.Errorf("%w:%v", ErrRunnerNotRegistered, req.Address)
+	}
+
+	info := value.(*runnerInfo)
+	info.setStats(req.TaskRunnerStatsResponse)
+	info.touch()
+	return TaskRunnerHeartbeatResponse{State: info.getState()}, nil
+}
+
+// Cordon 指定したTaskRunnerに新しいタスクを割り当てないようにする
+// 実行中のタスクはそのまま監視を続ける
+func (cod *Coordinator) Cordon(req TaskRunnerConnectionRequest) error {
+	info, err := cod.getRunner(req.Address)
+	if err != nil {
+		return err
+	}
+
+	info.setState(RunnerStateCordoned)
+	log.Println("TaskRunnerへの割り当てを停止しました:", req.Address)
+	return nil
+}
+
+// Uncordon 割り当てを停止したTaskRunnerへのタスクの割り当てを再開する
+// 退避中のTaskRunnerを指定した場合は退避を取りやめる
+// 退避が完了したTaskRunnerを指定した場合は再び登録を受け付ける。TaskRunnerは次の生存通知で再登録する
+func (cod *Coordinator) Uncordon(req TaskRunnerConnectionRequest) error {
+	info, err := cod.getRunner(req.Address)
+	if err != nil {
+		if _, drained := cod.drainedRunners.LoadAndDelete(req.Address); drained {
+			log.Println("退避済みのTaskRunnerの登録を再び受け付けます:", req.Address)
+			return nil
+		}
+		return err
+	}
+
+	info.setState(RunnerStateActive)
+	log.Println("TaskRunnerへの割り当てを再開しました:", req.Address)
+	cod.notifyRunnersChanged()
+	return nil
+}
+
+// runnersChangedChan タスクを割り当て可能なTaskRunnerが増えた時に閉じられるチャネルを取得する
+func (cod *Coordinator) runnersChangedChan() <-chan struct{} {
+	cod.runnersChangedLock.Lock()
+	defer cod.runnersChangedLock.Unlock()
+	return cod.runnersChanged
+}
+
+// notifyRunnersChanged タスクを割り当て可能なTaskRunnerが増えたことを開始待ちのタスクに知らせる
+func (cod *Coordinator) notifyRunnersChanged() {
+	cod.runnersChangedLock.Lock()
+	defer cod.runnersChangedLock.Unlock()
+	close(cod.runnersChanged)
+	cod.runnersChanged = make(chan struct{})
+}
+
+// Drain 指定したTaskRunnerに新しいタスクを割り当てないようにし、実行中のタスクがすべて終了したら接続を解除する
+func (cod *Coordinator) Drain(req TaskRunnerConnectionRequest) error {
+	info, err := cod.getRunner(req.Address)
+	if err != nil {
+		return err
+	}
+
+	if info.getState() == RunnerStateDraining {
+		return nil
+	}
+	info.setState(RunnerStateDraining)
+	log.Println("TaskRunnerの退避を開始しました:", req.Address)
+
+	go cod.waitDrained(info)
+	return nil
+}
+
+// waitDrained 退避中のTaskRunnerで実行中のタスクがなくなるまで待ち、接続を解除する
+// 接続を解除したTaskRunnerは退避済みとして記録し、自身で再登録しないようにする
+// 待っている間に退避が取りやめられるか接続が解除された場合は何もしない
+func (cod *Coordinator) waitDrained(info *runnerInfo) {
+	ticker := time.NewTicker(runnerDrainCheckInterval)
+	defer ticker.Stop()
+	for {
+		value, ok := cod.runnerAddrs.Load(info.addr)
+		if !ok || value.(*runnerInfo) != info || info.getState() != RunnerStateDraining {
+			return
+		}
+
+		if len(cod.runningTasks()[info.addr]) == 0 {
+			log.Println("TaskRunnerの退避が完了しました:", info.addr)
+			// 生存通知で未登録と判断されないよう、接続を解除する前に記録する
+			cod.drainedRunners.Store(info.addr, true)
+			cod.runnerAddrs.Delete(info.addr)
+			log.Println("TaskRunnerを切断しました:", info.addr)
+			return
+		}
+		<-ticker.C
+	}
+}
+
+// runningTasks Coordinatorが実行中として監視しているタスクをTaskRunnerごとに取得する
+func (cod *Coordinator) runningTasks() map[string][]RunnerTask {
+	tasks := map[string][]RunnerTask{}
+	addTasks := func(_, value interface{}) bool {
+		value.(*coordinatorJob).addRunningTasks(tasks)
+		return true
+	}
+	cod.jobs.Range(addTasks)
+	return tasks
+}
+
+func (cod *Coordinator) getRunner(addr string) (*runnerInfo, error) {
+	value, ok := cod.runnerAddrs.Load(addr)
+	if !ok {
+		return nil, fmt.Errorf("%w:%v", ErrRunnerNotRegistered, addr)
+	}
+	return value.(*runnerInfo), nil
+}
+
 func (cod *Coordinator) GetRunners() RunnerListResponse {
-	var runners []string
-	addRunner := func(addr, _ interface{}) bool {
-		runners = append(runners, addr.(string))
+	var response RunnerListResponse
+	runningTasks := cod.runningTasks()
+	addRunner := func(addr, value interface{}) bool {
+		response.Runners = append(response.Runners, addr.(string))
+		response.Statuses = append(response.Statuses, value.(*runnerInfo).status(runningTasks[addr.(string)]))
 		return true
 	}
 	cod.runnerAddrs.Range(addRunner)
-	return RunnerListResponse{Runners: runners}
+	response.Scheduler = cod.Scheduler.Name()
+	return response
 }
 
 func (cod *Coordinator) GetJobs() JobListResponse {
-	var jobs []string
-	addJob := func(job, _ interface{}) bool {
-		jobs = append(jobs, job.(string))
+	var response JobListResponse
+	addJob := func(jobID, value interface{}) bool {
+		state, transitions := value.(*coordinatorJob).getState()
+		summary := JobSummary{ID: jobID.(string), State: state}
+		if len(transitions) > 0 {
+			summary.UpdatedAt = transitions[len(transitions)-1].Time
+		}
+
+		response.Jobs = append(response.Jobs, summary.ID)
+		response.Summaries = append(response.Summaries, summary)
 		return true
 	}
 	cod.jobs.Range(addJob)
-	return JobListResponse{Jobs: jobs}
+	return response
 }
 
-func (cod *Coordinator) startTask(req *TaskStartRequest, targets *[]string) (string, string, error) {
-	var returnAddr, returnID string
-	taskStarted := false
+// callbackURL 指定したジョブのタスク完了通知先URLを取得する。完了通知を使用しない場合は空文字を返す
+func (cod *Coordinator) callbackURL(jobID string) string {
+	if cod.CallbackBaseURL == "" {
+		return ""
+	}
+	return fmt.Sprint(strings.TrimSuffix(cod.CallbackBaseURL, "/"), "/callback/", jobID)
+}
 
-	startFunc := func(addr, _ interface{}) bool {
+// startTask 対象のTaskRunnerからスケジューラーが選んだ順にタスク開始を試みる
+// 対象はラベルがselectorに一致し、アドレスがtargetsのどれかに部分一致するTaskRunnerとなる
+// excludesに含まれるTaskRunnerには割り当てない
+// 再試行しても開始できない場合はIsPermanentがtrueとなる*TaskStartErrorを返す
+func (cod *Coordinator) startTask(req *TaskStartRequest, targets *[]string, selector LabelSelector, excludes map[string]bool) (string, string, error) {
+	var candidates, excludedCandidates []RunnerLoad
+	targetNum, cordonedNum := 0, 0
+	addCandidate := func(addr, value interface{}) bool {
 		addrStr := addr.(string)
 
 		// 対象の指定がある場合は有効な対象かをチェック。対象外であればタスク開始は行わない。
-		if targets != nil {
-			isValidTarget := false
-			for _, target := range *targets {
-				if strings.Contains(addrStr, target) {
-					isValidTarget = true
-					break
-				}
-			}
-			if !isValidTarget {
-				return true
-			}
+		info := value.(*runnerInfo)
+		if !isTargetRunner(addrStr, targets) || !info.matches(selector) {
+			return true
 		}
+		targetNum++
 
-		id, err := requestStartTask(addrStr, req)
-		if err == nil {
-			returnAddr = addrStr
-			returnID = id
-			taskStarted = true
-			return false
+		if !info.supports(req.ProcName) {
+			return true
+		}
+		if info.getState() != RunnerStateActive {
+			cordonedNum++
+			return true
+		}
+		if excludes[addrStr] {
+			excludedCandidates = append(excludedCandidates, info.load())
+			return true
 		}
 
+		candidates = append(candidates, info.load())
 		return true
 	}
+	cod.runnerAddrs.Range(addCandidate)
+
+	// 除外したTaskRunner以外に対応するものがなければ除外したTaskRunnerを使用する
+	if len(candidates) == 0 {
+		candidates = excludedCandidates
+	}
+
+	unschedulableErr := &TaskStartError{Reason: TaskStartRejectUnschedulable, Message: fmt.Sprintf("%sに対応したTaskRunnerが接続されていません", req.ProcName)}
+	// 対応するTaskRunnerが割り当て停止中の場合は再開を待つ
+	if targetNum > 0 && len(candidates) == 0 && cordonedNum == 0 {
+		return "", "", unschedulableErr
+	}
+
+	order := cod.Scheduler.Order(req, candidates)
+	unknownProcNum := 0
+	for _, addr := range order {
+		resp, err := cod.runnerClient(addr).Start(context.Background(), *req)
+		if err == nil {
+			cod.addRunnerActiveTaskNum(addr, 1)
+			return addr, resp.ID, nil
+		}
 
-	cod.runnerAddrs.Range(startFunc)
+		var startErr *TaskStartError
+		if errors.As(err, &startErr) {
+			switch startErr.Reason {
+			case TaskStartRejectInvalidParams:
+				// パラメータの誤りは他のTaskRunnerでも解消しない
+				return "", "", startErr
+			case TaskStartRejectUnknownProc:
+				unknownProcNum++
+			}
+		}
+	}
 
-	if taskStarted {
-		return returnAddr, returnID, nil
+	if len(order) > 0 && unknownProcNum == len(order) {
+		return "", "", unschedulableErr
 	}
 
 	return "", "", errors.New("タスクを開始出来ませんでした")
 }
 
-// requestStartTask 指定したTaskRunnerサーバーにタスク開始をリクエストする
-func requestStartTask(runnerAddr string, req *TaskStartRequest) (string, error) {
-	url := fmt.Sprint(runnerAddr, "/start")
-	json, err := json.Marshal(req)
-	if err != nil {
-		return "", err
+// validateJobRequest ジョブ開始リクエストの内容と各タスクのパラメータを検証する
+// 問題がある場合は見つかった問題をすべて含む*JobRequestErrorを返す
+func (cod *Coordinator) validateJobRequest(req JobStartRequest) error {
+	var violations []string
+	if err := validateJobRequest(req); err != nil {
+		var reqErr *JobRequestError
+		if !errors.As(err, &reqErr) {
+			return err
+		}
+		violations = append(violations, reqErr.Violations...)
 	}
 
-	res, err := http.Post(url, "application/json", bytes.NewBuffer(json))
-	if err != nil {
-		return "", err
+	for i := range req.Tasks {
+		for _, violation := range cod.validateTaskParams(req, i) {
+			violations = append(violations, fmt.Sprintf("tasks[%d]のパラメータが不正です %s", i, violation))
+		}
+	}
+
+	if len(violations) > 0 {
+		return &JobRequestError{Violations: violations}
 	}
-	defer res.Body.Close()
+	return nil
+}
+
+// validateTaskParams タスクのパラメータを割り当て先になり得るTaskRunnerのスキーマで検証し、見つかった問題を返す
+// どれかのTaskRunnerのスキーマを満たしていれば問題なしとする
+// 割り当て先になり得るTaskRunnerがない場合や、スキーマを登録していないTaskRunnerがある場合は検証しない
+func (cod *Coordinator) validateTaskParams(req JobStartRequest, index int) []string {
+	task := req.Tasks[index]
+	selector := append(append(LabelSelector{}, req.Selector...), task.Selector...)
+
+	var addrs []string
+	schemas := map[string]*ParamsSchema{}
+	unknownSchema := false
+	cod.runnerAddrs.Range(func(addr, value interface{}) bool {
+		addrStr := addr.(string)
+		info := value.(*runnerInfo)
+		if !isTargetRunner(addrStr, req.TargetFilters) || !info.matches(selector) || !info.supports(task.ProcName) {
+			return true
+		}
 
-	if res.StatusCode != http.StatusOK {
-		return "", errors.New("タスク開始に失敗しました")
+		schema := info.paramsSchema(task.ProcName)
+		if schema == nil {
+			unknownSchema = true
+			return false
+		}
+		addrs = append(addrs, addrStr)
+		schemas[addrStr] = schema
+		return true
+	})
+	if unknownSchema || len(addrs) == 0 {
+		return nil
 	}
 
-	var startResponse TaskStartResponse
-	err = ReadJSONFromResponse(res, &startResponse)
-	if err != nil {
-		return "", err
+	// どのスキーマも満たさない場合はアドレス順で最初のTaskRunnerのスキーマでの問題を返す
+	sort.Strings(addrs)
+	var firstViolations []string
+	for i, addr := range addrs {
+		violations := schemas[addr].ValidateParams(task.Params)
+		if len(violations) == 0 {
+			return nil
+		}
+		if i == 0 {
+			firstViolations = violations
+		}
 	}
+	return firstViolations
+}
+
+// isTargetRunner 指定したTaskRunnerがフィルターリストのどれかに部分一致するかを調べる
+// フィルターの指定がない場合は全TaskRunnerが対象となる
+func isTargetRunner(addr string, targets *[]string) bool {
+	if targets == nil {
+		return true
+	}
+
+	for _, target := range *targets {
+		if strings.Contains(addr, target) {
+			return true
+		}
+	}
+	return false
+}
 
-	return startResponse.ID, nil
+// isConnected 指定したTaskRunnerが接続されているかを調べる
+func (cod *Coordinator) isConnected(addr string) bool {
+	_, ok := cod.runnerAddrs.Load(addr)
+	return ok
 }
 
-func (cod *Coordinator) newJob() (string, error) {
+// addRunnerActiveTaskNum Coordinatorが把握しているTaskRunnerの実行中タスク数を増減させる
+// 次の負荷状況取得までの間、スケジューラーに割り当て結果を反映させるために使用する
+func (cod *Coordinator) addRunnerActiveTaskNum(addr string, delta int) {
+	value, ok := cod.runnerAddrs.Load(addr)
+	if !ok {
+		return
+	}
+	value.(*runnerInfo).addActiveTaskNum(delta)
+}
+
+// runnerClient 指定したTaskRunnerのAPIを呼び出すクライアントを作成する
+func (cod *Coordinator) runnerClient(addr string) TaskRunnerClient {
+	return cod.RunnerClientFactory(addr)
+}
+
+// cancelRunnerTask TaskRunnerへタスクのキャンセルをリクエストする
+// 失敗した場合はtaskCancelRetryNum回まで試みる
+func (cod *Coordinator) cancelRunnerTask(addr, taskID string) error {
+	var err error
+	for i := 0; i < taskCancelRetryNum; i++ {
+		if i > 0 {
+			time.Sleep(taskCancelRetryInterval)
+		}
+		if err = cod.runnerClient(addr).Cancel(context.Background(), taskID); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (cod *Coordinator) newJob(req JobStartRequest) (string, error) {
 
 	id, err := uuid.NewRandom()
 	if err != nil {
@@ -208,17 +596,46 @@ func (cod *Coordinator) newJob() (string, error) {
 		return "", errors.New("ID重複")
 	}
 
-	writer := &WriterWithHandler{Writer: log.Default().Writer(), Handler: cod.Handler, Id: id.String()}
-	logger := log.New(writer, fmt.Sprintf("[%s]", id.String()), log.Default().Flags())
-	cod.jobs.Store(id.String(), newCoordinatorJob(id.String(), *logger))
+	cod.jobs.Store(id.String(), newCoordinatorJob(id.String(), req, cod.newJobLogger(id.String()), cod.Store))
 
 	return id.String(), nil
 }
 
+// LoadJobs JobStoreに保存されているジョブを読み込む
+// 完了していないジョブは割り当て済みタスクの監視と未割り当てタスクの開始を再開する
+// Storeが指定されていない場合は何もしない
+func (cod *Coordinator) LoadJobs() error {
+	if cod.Store == nil {
+		return nil
+	}
+
+	records, err := cod.Store.LoadJobs()
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		job := newCoordinatorJobFromRecord(record, cod.newJobLogger(record.ID), cod.Store)
+		cod.jobs.Store(record.ID, job)
+		if !record.Completed {
+			go job.resume(cod)
+		}
+	}
+
+	log.Printf("ジョブを%d件読み込みました", len(records))
+	cod.collectFinishedJobs()
+	return nil
+}
+
+func (cod *Coordinator) newJobLogger(jobID string) *log.Logger {
+	writer := &WriterWithHandler{Writer: log.Default().Writer(), Handler: cod.Handler, Id: jobID}
+	return log.New(writer, fmt.Sprintf("[%s]", jobID), log.Default().Flags())
+}
+
 func (cod *Coordinator) getJob(jobID string) (*coordinatorJob, error) {
 	value, ok := cod.jobs.Load(jobID)
 	if !ok {
-		return nil, fmt.Errorf("ジョブID %v は存在しません", jobID)
+		return nil, fmt.Errorf("%w:%v", ErrJobNotFound, jobID)
 	}
 
 	job, ok := value.(*coordinatorJob)
@@ -229,18 +646,94 @@ func (cod *Coordinator) getJob(jobID string) (*coordinatorJob, error) {
 	return job, nil
 }
 
-// checkAliveTaskRunners 接続しているTaskRunnerが生存しているかを確認し、生存していなければ接続リストから削除する
+// removeJob ジョブを一覧とJobStoreから削除する
+func (cod *Coordinator) removeJob(job *coordinatorJob) error {
+	cod.jobs.Delete(job.id)
+	if err := job.delete(); err != nil {
+		return err
+	}
+	log.Println("ジョブを削除しました:", job.id)
+	return nil
+}
+
+// collectFinishedJobs 保持方針に従って終了したジョブを削除する
+// JobRetentionを過ぎたジョブを削除した後、MaxFinishedJobsを超えた分を終了時刻が古いものから削除する
+func (cod *Coordinator) collectFinishedJobs() {
+	if cod.JobRetention <= 0 && cod.MaxFinishedJobs <= 0 {
+		return
+	}
+
+	type finishedJob struct {
+		job        *coordinatorJob
+		finishedAt time.Time
+	}
+	var finishedJobs []finishedJob
+	now := time.Now()
+	addFinishedJob := func(_, value interface{}) bool {
+		job := value.(*coordinatorJob)
+		state, transitions := job.getState()
+		if !isJobStateFinished(state) {
+			return true
+		}
+
+		var finishedAt time.Time
+		if len(transitions) > 0 {
+			finishedAt = transitions[len(transitions)-1].Time
+		}
+		if cod.JobRetention > 0 && now.Sub(finishedAt) > cod.JobRetention {
+			if err := cod.removeJob(job); err != nil {
+				log.Println("ジョブの削除に失敗しました:", job.id, err)
+			}
+			return true
+		}
+
+		finishedJobs = append(finishedJobs, finishedJob{job: job, finishedAt: finishedAt})
+		return true
+	}
+	cod.jobs.Range(addFinishedJob)
+
+	if cod.MaxFinishedJobs <= 0 || len(finishedJobs) <= cod.MaxFinishedJobs {
+		return
+	}
+	sort.Slice(finishedJobs, func(i, j int) bool {
+		return finishedJobs[i].finishedAt.Before(finishedJobs[j].finishedAt)
+	})
+	for _, finished := range finishedJobs[:len(finishedJobs)-cod.MaxFinishedJobs] {
+		if err := cod.removeJob(finished.job); err != nil {
+			log.Println("ジョブの削除に失敗しました:", finished.job.id, err)
+		}
+	}
+}
+
+// removeDeadTaskRunners 接続しているTaskRunnerの生存を確認し、RunnerTimeoutの間生存が確認できなければ接続リストから削除する
+// 生存通知を受け取った場合も生存を確認できたものとして扱う
 func (cod *Coordinator) removeDeadTaskRunners() {
 	var wg sync.WaitGroup
 	for _, runnerAddr := range cod.GetRunners().Runners {
 		wg.Add(1)
 		go func(addr string) {
 			defer wg.Done()
-			url := fmt.Sprint(addr, "/alive")
-			resp, err := http.Get(url)
-			if err != nil || resp.StatusCode != http.StatusOK {
-				log.Println("TaskRunnerが生存していません:", addr)
-				cod.Disconnect(TaskRunnerConnectionRequest{Address: addr})
+			value, ok := cod.runnerAddrs.Load(addr)
+			if !ok {
+				return
+			}
+			info := value.(*runnerInfo)
+
+			client := cod.runnerClient(addr)
+			if err := client.Alive(context.Background()); err != nil {
+				info.healthCheckFailed()
+				if info.expired(cod.RunnerTimeout) {
+					log.Println("TaskRunnerが生存していません:", addr)
+					cod.Disconnect(TaskRunnerConnectionRequest{Address: addr})
+				} else {
+					log.Println("TaskRunnerの生存確認に失敗しました:", addr)
+				}
+				return
+			}
+			info.touch()
+
+			if err := info.update(client); err != nil {
+				log.Println("TaskRunnerの情報取得に失敗しました:", addr, err)
 			}
 		}(runnerAddr)
 	}
@@ -2,155 +2,872 @@ package gojobcoordinatortest
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"net/http"
 	"sync"
 	"time"
 )
 
+// taskInfo ジョブ内のタスクの割り当て情報
+// id,runnderAddrには最後の試行で割り当てたタスクが入る。未割り当ての場合はidが空となる
+// err,reasonには実行を完了できずに終了したタスクのエラー内容と理由が入る
+// attemptsにはこれまでの試行履歴が入る
+// stateにはTaskState〜の値が入る
+// resultValuesには成功したタスクの結果値が入る
+// lastStatus,statusUpdatedAtには監視中に最後に取得できたタスクの状態とその時刻、lastErrorには最後の状態取得で発生したエラーが入る
 type taskInfo struct {
-	id          string
-	runnderAddr string
+	state           string
+	id              string
+	runnderAddr     string
+	err             string
+	reason          string
+	attempts        []TaskAttempt
+	resultValues    *map[string]interface{}
+	lastStatus      *TaskStatusResponse
+	statusUpdatedAt *time.Time
+	lastError       string
+	cancelRequested bool
 }
 
+// taskCallback TaskRunnerからのタスク完了通知の受け取り先
+// 完了通知を受け取るとdoneが閉じられる
+// watchedは開始したタスクとして監視対象になっているかを表す。監視対象でない受け取り先はタスク開始中に届いた通知のために一時的に作成されたもの
+type taskCallback struct {
+	done    chan struct{}
+	once    sync.Once
+	status  TaskStatusResponse
+	watched bool
+}
+
+const (
+	// taskStartRetryInterval タスク開始に失敗した時に再度開始を試みるまでの間隔
+	taskStartRetryInterval = time.Second * 30
+	// taskStatusPollInterval 完了通知を使用しない場合のタスク状態確認間隔
+	taskStatusPollInterval = time.Second * 30
+	// taskStatusFallbackPollInterval 完了通知を使用する場合のタスク状態確認間隔。完了通知が届かなかった場合の保険として確認する
+	taskStatusFallbackPollInterval = time.Minute * 2
+	// taskStatusFailureLimit タスク状態の取得がこの回数連続で失敗したらTaskRunnerと通信できなくなったとみなす
+	taskStatusFailureLimit = 3
+	// taskCancelPollInterval キャンセルリクエストを送った後のタスク状態確認間隔
+	taskCancelPollInterval = time.Second
+	// taskCancelRetryNum TaskRunnerへのキャンセルリクエストを試みる回数
+	taskCancelRetryNum = 3
+	// taskCancelRetryInterval TaskRunnerへのキャンセルリクエストに失敗した時に再度試みるまでの間隔
+	taskCancelRetryInterval = time.Second
+)
+
 type coordinatorJob struct {
+	req           JobStartRequest
+	deps          [][]int
+	taskDones     []chan struct{}
 	taskInfos     []taskInfo
 	taskInfosLock sync.Mutex
+	callbacks     map[string]*taskCallback
+	startingNum   int
+	callbacksLock sync.Mutex
 	cancelFunc    context.CancelFunc
-	busy          bool
+	started       bool
+	cancelled     bool
+	timedOut      bool
+	state         string
+	transitions   []JobStateTransition
 	id            string
-	logger        log.Logger
+	logger        *log.Logger
+	store         JobStore
+	saveLock      sync.Mutex
+	saveDirty     bool
+	saving        bool
+	writeLock     sync.Mutex
+	deleted       bool
 }
 
-func newCoordinatorJob(jobID string, logger log.Logger) *coordinatorJob {
-	return &coordinatorJob{id: jobID, logger: logger}
+// newCoordinatorJob ジョブの作成
+// taskInfosはreq.Tasksと同じ並びで各タスクの割り当て先を保持する。未割り当てのタスクはidが空となる。
+// depsには各タスクが依存するタスクの位置、taskDonesにはタスクが終了した時に閉じられるチャネルが入る
+// 依存関係はジョブ開始時に検証済みのため、解析できない場合は依存関係なしとして扱う
+func newCoordinatorJob(jobID string, req JobStartRequest, logger *log.Logger, store JobStore) *coordinatorJob {
+	deps, err := buildTaskGraph(req.Tasks)
+	if err != nil {
+		logger.Printf("タスクの依存関係を解析できませんでした:%v", err)
+		deps = make([][]int, len(req.Tasks))
+	}
+
+	job := &coordinatorJob{id: jobID, req: req, deps: deps, taskInfos: make([]taskInfo, len(req.Tasks)), callbacks: map[string]*taskCallback{}, logger: logger, store: store}
+	job.taskDones = make([]chan struct{}, len(req.Tasks))
+	for i := range req.Tasks {
+		job.taskDones[i] = make(chan struct{})
+		if len(deps[i]) > 0 {
+			job.taskInfos[i].state = TaskStateBlocked
+		} else {
+			job.taskInfos[i].state = TaskStatePending
+		}
+	}
+	job.updateStateLocked()
+	return job
+}
+
+// newCoordinatorJobFromRecord JobStoreに保存されていた情報からジョブを復元する
+func newCoordinatorJobFromRecord(record JobRecord, logger *log.Logger, store JobStore) *coordinatorJob {
+	job := newCoordinatorJob(record.ID, record.Request, logger, store)
+	for i := 0; i < len(job.taskInfos) && i < len(record.Tasks); i++ {
+		task := record.Tasks[i]
+		state := task.State
+		if state == "" {
+			state = job.taskInfos[i].state
+		}
+		job.taskInfos[i] = taskInfo{state: state, id: task.ID, runnderAddr: task.RunnerAddr, err: task.Error, reason: task.Reason, attempts: task.Attempts, resultValues: task.ResultValues,
+			lastStatus: task.LastStatus, statusUpdatedAt: task.StatusUpdatedAt, lastError: task.LastError}
+	}
+
+	job.cancelled = record.Cancelled
+	job.timedOut = record.TimedOut
+	if record.State != "" {
+		job.started = record.State != JobStatePending
+		job.state = record.State
+		job.transitions = record.Transitions
+	} else {
+		// 状態が保存されていない古い情報は完了済みかどうかから求める
+		job.started = true
+		if record.Completed {
+			for i := range job.taskInfos {
+				if !isTaskStateFinished(job.taskInfos[i].state) {
+					job.taskInfos[i].state = TaskStateFailed
+				}
+			}
+		}
+		job.updateStateLocked()
+	}
+	return job
 }
 
-func (j *coordinatorJob) run(cod *Coordinator, jobReq *JobStartRequest) {
-	j.busy = true
+func (j *coordinatorJob) run(cod *Coordinator) {
 	j.logger.Print("Start Job.")
+	j.runTasks(cod)
+}
 
-	var ctx context.Context
-	ctx, j.cancelFunc = context.WithCancel(context.Background())
+// resume Coordinator再起動前に開始していたジョブを再開する
+// 割り当て済みのタスクは監視のみ行い、未割り当てのタスクは改めて開始する
+func (j *coordinatorJob) resume(cod *Coordinator) {
+	j.logger.Print("Resume Job.")
+	j.runTasks(cod)
+}
+
+func (j *coordinatorJob) runTasks(cod *Coordinator) {
+	j.taskInfosLock.Lock()
+	ctx := j.newContextLocked()
+	j.started = true
+	j.updateStateLocked()
+	j.taskInfosLock.Unlock()
+	j.save()
+	defer j.cancelFunc()
 
 	var wg sync.WaitGroup
-	for i := 0; i < len(jobReq.Tasks); i++ {
+	for i := 0; i < len(j.req.Tasks); i++ {
 		wg.Add(1)
-		go j.runTask(ctx, &wg, cod, &jobReq.Tasks[i], jobReq.TargetFilters)
+		go j.runTask(ctx, &wg, cod, i)
 	}
 	wg.Wait()
 
-	j.busy = false
-	j.logger.Print("Complete Job.")
+	state, _ := j.getState()
+	j.logger.Printf("Complete Job. State:%v", state)
+
+	cod.collectFinishedJobs()
+}
+
+// newContextLocked ジョブの実行に使うcontextを作成する
+// 制限時間を過ぎた場合は割り当て待ちのタスクを諦め、実行中のタスクをキャンセルする
+// 実行開始前にキャンセルが記録されていた場合は、タスクを開始しないよう作成時点でキャンセルする
+// taskInfosLockを取得した状態で呼び出す
+func (j *coordinatorJob) newContextLocked() context.Context {
+	var ctx context.Context
+	if j.req.Deadline != nil {
+		ctx, j.cancelFunc = context.WithDeadline(context.Background(), *j.req.Deadline)
+	} else {
+		ctx, j.cancelFunc = context.WithCancel(context.Background())
+	}
+	if j.cancelled {
+		j.cancelFunc()
+	}
+	return ctx
 }
 
-func (j *coordinatorJob) runTask(ctx context.Context, wg *sync.WaitGroup, cod *Coordinator, taskReq *TaskStartRequest, targets *[]string) {
+// runTask タスクの開始から完了までを管理する
+// タスクが失敗した場合やTaskRunnerと通信できなくなった場合は再試行方針に従って別のTaskRunnerで再試行する
+func (j *coordinatorJob) runTask(ctx context.Context, wg *sync.WaitGroup, cod *Coordinator, index int) {
 	defer wg.Done()
+	defer close(j.taskDones[index])
+
+	policy := j.retryPolicy(index)
+	excludes := map[string]bool{}
+
+	j.taskInfosLock.Lock()
+	info := j.taskInfos[index]
+	j.taskInfosLock.Unlock()
+
+	if isTaskStateFinished(info.state) || info.err != "" {
+		// Coordinator再起動前に終了していたタスク
+		return
+	}
+
+	if !j.waitDependencies(ctx, index) {
+		if ctx.Err() != nil {
+			j.abortTask(ctx, index)
+		}
+		return
+	}
+
+	// パラメータ内の依存先タスクの結果値を参照するプレースホルダを解決する
+	params, err := resolveParams(j.req.Tasks[index].Params, j.taskResults())
+	if err != nil {
+		j.setTaskError(index, TaskErrorUnresolvedParams, err.Error())
+		return
+	}
+
+	// Coordinator再起動前に開始していたタスクは監視から再開する
+	resumed := info.id != ""
+	if resumed {
+		j.logger.Printf("TaskRunner %v で開始済みのTaskID %v の監視を再開します\n", info.runnderAddr, info.id)
+	}
 
-	// タスク開始成功するまで繰り返す
-	var runnerAddr, taskID string
-	ticker := time.NewTicker(time.Second * 30)
 	for {
+		if !resumed && !j.startTask(ctx, cod, index, params, excludes) {
+			if ctx.Err() != nil {
+				j.abortTask(ctx, index)
+			}
+			return
+		}
+
+		taskStatus, err := j.monitorTask(ctx, cod, index, resumed)
+		resumed = false
+		status := taskStatus.Status
+		runnerAddr, attemptNum := j.finishAttempt(index, status, err)
+		if err == nil {
+			// 結果は取得済みのため、TaskRunnerに残っているタスクを削除する
+			if err := cod.runnerClient(runnerAddr).Delete(context.Background(), taskStatus.ID); err != nil {
+				j.logger.Printf("TaskRunner %v で開始したTaskID %v の削除に失敗しました %v", runnerAddr, taskStatus.ID, err)
+			}
+		}
+		if status == StatusSuccess {
+			j.taskInfosLock.Lock()
+			j.taskInfos[index].resultValues = taskStatus.ResultValues
+			j.taskInfosLock.Unlock()
+			j.setTaskState(index, TaskStateSucceeded)
+			return
+		}
+		if ctx.Err() != nil {
+			j.abortTask(ctx, index)
+			return
+		}
+		// TaskRunnerへ直接キャンセルが指示された場合は再試行しない
+		if status == StatusCancelled {
+			j.setTaskState(index, TaskStateCancelled)
+			return
+		}
+
+		if attemptNum >= policy.MaxAttempts {
+			switch status {
+			case AttemptStatusRunnerLost:
+				j.setTaskError(index, AttemptStatusRunnerLost, err.Error())
+			case StatusTimedOut:
+				j.setTaskState(index, TaskStateTimedOut)
+			default:
+				j.setTaskState(index, TaskStateFailed)
+			}
+			return
+		}
+
+		// 通信できなくなったTaskRunnerには再度割り当てない
+		if status == AttemptStatusRunnerLost {
+			excludes[runnerAddr] = true
+		}
+
+		j.setTaskState(index, TaskStatePending)
+		backoff := policy.backoff(attemptNum)
+		j.logger.Printf("%v後にタスクを再試行します 試行回数:%d/%d\n", backoff, attemptNum, policy.MaxAttempts)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			j.abortTask(ctx, index)
+			return
+		}
+	}
+}
+
+// waitDependencies 依存先タスクがすべて終了するまで待つ
+// 依存先がすべて成功した場合はtrueを返す。依存先が成功しなかった場合はタスクをスキップしてfalseを返す
+func (j *coordinatorJob) waitDependencies(ctx context.Context, index int) bool {
+	for _, dep := range j.deps[index] {
+		select {
+		case <-j.taskDones[dep]:
+		case <-ctx.Done():
+			return false
+		}
+
+		j.taskInfosLock.Lock()
+		depState := j.taskInfos[dep].state
+		j.taskInfosLock.Unlock()
+
+		if depState != TaskStateSucceeded {
+			j.logger.Printf("依存先のtasks[%d]が成功しなかったためtasks[%d]をスキップします\n", dep, index)
+			j.setTaskState(index, TaskStateSkipped)
+			return false
+		}
+	}
+
+	j.taskInfosLock.Lock()
+	if j.taskInfos[index].state == TaskStateBlocked {
+		j.setTaskStateLocked(index, TaskStatePending)
+	}
+	j.taskInfosLock.Unlock()
+	j.save()
+	return true
+}
+
+// taskResults IDを持つタスクの結果値をタスクIDごとに取得する
+func (j *coordinatorJob) taskResults() map[string]*map[string]interface{} {
+	j.taskInfosLock.Lock()
+	defer j.taskInfosLock.Unlock()
+
+	results := map[string]*map[string]interface{}{}
+	for i, info := range j.taskInfos {
+		if id := j.req.Tasks[i].ID; id != "" {
+			results[id] = info.resultValues
+		}
+	}
+	return results
+}
+
+// startTask タスク開始に成功するまで繰り返す
+// paramsにはプレースホルダを解決したパラメータを指定する
+// キャンセルされた場合や再試行しても開始できない場合はfalseを返す
+func (j *coordinatorJob) startTask(ctx context.Context, cod *Coordinator, index int, params *map[string]interface{}, excludes map[string]bool) bool {
+	taskReq := j.req.Tasks[index].TaskStartRequest
+	taskReq.Params = params
+	taskReq.CallbackURL = cod.callbackURL(j.id)
+	if j.req.Deadline != nil && (taskReq.Deadline == nil || j.req.Deadline.Before(*taskReq.Deadline)) {
+		// ジョブの制限時間はTaskRunner側でも守らせる
+		taskReq.Deadline = j.req.Deadline
+	}
+	// タスクがどのジョブの何回目の試行として実行されるかを伝える
+	j.taskInfosLock.Lock()
+	taskReq.JobID, taskReq.TaskIndex, taskReq.Attempt = j.id, index, len(j.taskInfos[index].attempts)+1
+	j.taskInfosLock.Unlock()
+	selector := append(append(LabelSelector{}, j.req.Selector...), j.req.Tasks[index].Selector...)
+
+	ticker := time.NewTicker(taskStartRetryInterval)
+	defer ticker.Stop()
+	for {
+		// キャンセル後は割り当て待ちのタスクを開始しない
+		if ctx.Err() != nil {
+			return false
+		}
 		j.logger.Printf("タスク開始を試みます\n")
 
-		var err error
-		runnerAddr, taskID, err = cod.startTask(taskReq, targets)
+		runnersChanged := cod.runnersChangedChan()
+		j.beginTaskStart()
+		runnerAddr, taskID, err := cod.startTask(&taskReq, j.req.TargetFilters, selector, excludes)
+		if err == nil {
+			j.watchTaskCallback(taskID)
+		}
+		j.endTaskStart()
 		if err == nil {
 			j.taskInfosLock.Lock()
-			j.taskInfos = append(j.taskInfos, taskInfo{id: taskID, runnderAddr: runnerAddr})
+			info := &j.taskInfos[index]
+			info.id = taskID
+			info.runnderAddr = runnerAddr
+			info.cancelRequested = false
+			info.attempts = append(info.attempts, TaskAttempt{TaskID: taskID, RunnerAddr: runnerAddr, Status: StatusBusy, StartedAt: time.Now()})
+			j.setTaskStateLocked(index, TaskStateRunning)
 			j.taskInfosLock.Unlock()
+			j.save()
 			j.logger.Printf("TaskRunner %v でタスクを開始しました %v\n", runnerAddr, taskID)
-			break
+			return true
+		}
+
+		// 再試行しても開始できない場合は失敗として終了
+		var startErr *TaskStartError
+		if errors.As(err, &startErr) && startErr.IsPermanent() {
+			j.setTaskError(index, startErr.Reason, startErr.Message)
+			return false
 		}
 
+		// 割り当て可能なTaskRunnerが増えた場合は間隔を待たずに再度開始を試みる
 		select {
 		case <-ticker.C:
+		case <-runnersChanged:
 		case <-ctx.Done():
 			// キャンセルされれば終了
-			return
+			return false
 		}
 	}
+}
+
+// monitorTask 開始したタスクが完了するまで監視し、完了時の状態を返す
+// 完了通知が届くか、ポーリングで完了が確認できるまで繰り返す
+// TaskRunnerと通信できなくなった場合はStatusがAttemptStatusRunnerLostの状態とその原因を返す
+// TaskRunnerの接続が解除されていても、記録したアドレスから状態を取得できる間は監視を続ける
+// resumedにはCoordinator再起動前に開始していたタスクの監視を再開する場合にtrueを指定する。
+// TaskRunnerが再登録するまでRunnerTimeoutの間は、接続されておらず状態を取得できなくても通信できなくなったとは扱わない
+func (j *coordinatorJob) monitorTask(ctx context.Context, cod *Coordinator, index int, resumed bool) (TaskStatusResponse, error) {
+	j.taskInfosLock.Lock()
+	runnerAddr, taskID := j.taskInfos[index].runnderAddr, j.taskInfos[index].id
+	j.taskInfosLock.Unlock()
+
+	callback := j.watchTaskCallback(taskID)
+	defer j.removeTaskCallback(taskID)
+
+	pollInterval := taskStatusPollInterval
+	if cod.CallbackBaseURL != "" {
+		pollInterval = taskStatusFallbackPollInterval
+	}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	var reconnectDeadline time.Time
+	if resumed {
+		reconnectDeadline = time.Now().Add(cod.RunnerTimeout)
+	}
 
-	// 開始成功したら完了するまで繰り返す
+	ctxDone := ctx.Done()
+	statusFailureNum := 0
 	for {
-		status, err := getTaskStatus(runnerAddr, taskID)
+		status, err := cod.runnerClient(runnerAddr).Status(context.Background(), taskID)
 		if err != nil {
-			j.logger.Println(err)
-			return
+			err = fmt.Errorf("TaskRunner %v で開始したTaskID %v のステータス取得でエラーが発生しました。 %v", runnerAddr, taskID, err)
 		}
-
-		if status.Status != StatusBusy {
-			j.logger.Printf("TaskRunner %v で開始したTaskID %v が完了しました。", runnerAddr, taskID)
-			return
+		j.cacheTaskStatus(index, &status, err)
+		if err != nil {
+			j.logger.Println(err)
+			statusFailureNum++
+			if !cod.isConnected(runnerAddr) {
+				if time.Now().Before(reconnectDeadline) {
+					// 再起動直後はTaskRunnerの再登録を待つ
+					statusFailureNum = 0
+				} else {
+					j.logger.Printf("TaskRunner %v の接続が解除されました TaskID:%v", runnerAddr, taskID)
+					err := fmt.Errorf("TaskRunner %v の接続が解除されました", runnerAddr)
+					j.cacheTaskStatus(index, nil, err)
+					return TaskStatusResponse{ID: taskID, Status: AttemptStatusRunnerLost}, err
+				}
+			} else if statusFailureNum >= taskStatusFailureLimit {
+				// 実行を続けている可能性があるため、再試行で二重に実行されないようキャンセルを試みる
+				cod.runnerClient(runnerAddr).Cancel(context.Background(), taskID)
+				return TaskStatusResponse{ID: taskID, Status: AttemptStatusRunnerLost}, err
+			}
+		} else {
+			statusFailureNum = 0
+			if status.Status != StatusBusy {
+				j.logger.Printf("TaskRunner %v で開始したTaskID %v が完了しました。", runnerAddr, taskID)
+				cod.addRunnerActiveTaskNum(runnerAddr, -1)
+				return status, nil
+			}
 		}
 
 		select {
+		case <-callback.done:
+			j.cacheTaskStatus(index, &callback.status, nil)
+			j.logger.Printf("TaskRunner %v で開始したTaskID %v が完了しました。", runnerAddr, taskID)
+			cod.addRunnerActiveTaskNum(runnerAddr, -1)
+			return callback.status, nil
 		case <-ticker.C:
-		case <-ctx.Done():
+		case <-ctxDone:
 			// キャンセル指示があればキャンセルリクエストを投げる
-			cancelRes, err := http.Post(fmt.Sprint(runnerAddr, "/cancel/", taskID), "", nil)
-			if err != nil || cancelRes.StatusCode != http.StatusOK {
-				j.logger.Printf("TaskRunner %v で開始したTaskID %v へのキャンセルに失敗しました。", runnerAddr, taskID)
-				if err != nil {
+			// Coordinator.Cancelですでにリクエストされている場合は送らない
+			if j.claimCancelRequest(index, taskID) {
+				if err := cod.cancelRunnerTask(runnerAddr, taskID); err != nil {
+					j.logger.Printf("TaskRunner %v で開始したTaskID %v へのキャンセルに失敗しました。", runnerAddr, taskID)
 					j.logger.Print(err)
+					return TaskStatusResponse{ID: taskID, Status: StatusFailure}, err
 				}
-				return
 			}
+			// キャンセルリクエストは一度だけ送り、タスクが終了するまで短い間隔で確認する
+			ctxDone = nil
+			ticker.Reset(taskCancelPollInterval)
+		}
+	}
+}
+
+// cacheTaskProgress TaskRunnerから通知された実行中のタスクの状態を保持する
+// 通知されたタスクが実行中でない場合は、完了後に届いた古い通知のため無視する
+func (j *coordinatorJob) cacheTaskProgress(status TaskStatusResponse) {
+	j.taskInfosLock.Lock()
+	defer j.taskInfosLock.Unlock()
+
+	for i := range j.taskInfos {
+		info := &j.taskInfos[i]
+		if info.id != status.ID || info.state != TaskStateRunning {
+			continue
 		}
+
+		statusCopy := status
+		now := time.Now()
+		info.lastStatus = &statusCopy
+		info.statusUpdatedAt = &now
+		info.lastError = ""
+		return
 	}
 }
 
-func getTaskStatus(runnerAddr, taskID string) (TaskStatusResponse, error) {
-	var result TaskStatusResponse
+// cacheTaskStatus 監視中に取得したタスクの状態を保持する
+// 取得に失敗した場合は最後に取得できた状態を残したままエラーを記録する
+func (j *coordinatorJob) cacheTaskStatus(index int, status *TaskStatusResponse, err error) {
+	j.taskInfosLock.Lock()
+	defer j.taskInfosLock.Unlock()
 
-	statusURL := fmt.Sprint(runnerAddr, "/status/", taskID)
-	res, err := http.Get(statusURL)
+	info := &j.taskInfos[index]
 	if err != nil {
-		return result, fmt.Errorf("TaskRunner %v で開始したTaskID %v のステータス取得でエラーが発生しました。 %v", runnerAddr, taskID, err)
+		info.lastError = err.Error()
+		return
 	}
 
-	if res.StatusCode != http.StatusOK {
-		return result, fmt.Errorf("TaskRunner %v で開始したTaskID %v のステータス取得でエラーが発生しました。 %v", runnerAddr, taskID, err)
+	statusCopy := *status
+	now := time.Now()
+	info.lastStatus = &statusCopy
+	info.statusUpdatedAt = &now
+	info.lastError = ""
+}
+
+// claimCancelRequest 実行中のタスクへのキャンセルリクエストを送る役割を得る
+// 同じタスクへのキャンセルリクエストがまだ送られていない場合はtrueを返す
+func (j *coordinatorJob) claimCancelRequest(index int, taskID string) bool {
+	j.taskInfosLock.Lock()
+	defer j.taskInfosLock.Unlock()
+
+	info := &j.taskInfos[index]
+	if info.id != taskID || info.cancelRequested {
+		return false
 	}
+	info.cancelRequested = true
+	return true
+}
 
-	err = ReadJSONFromResponse(res, &result)
-	res.Body.Close()
-	if err != nil {
-		return result, fmt.Errorf("TaskRunner %v で開始したTaskID %v のステータス解析でエラーが発生しました。 %v", runnerAddr, taskID, err)
+// retryPolicy 指定したタスクに適用する再試行方針を取得する
+func (j *coordinatorJob) retryPolicy(index int) RetryPolicy {
+	if policy := j.req.Tasks[index].RetryPolicy; policy != nil {
+		return *policy
 	}
+	if j.req.RetryPolicy != nil {
+		return *j.req.RetryPolicy
+	}
+	return RetryPolicy{}
+}
 
-	return result, nil
+// backoff attemptNum回目の試行が終わった後、再試行するまでの待機時間
+func (policy RetryPolicy) backoff(attemptNum int) time.Duration {
+	sec := policy.BackoffSec
+	for i := 1; i < attemptNum; i++ {
+		sec *= 2
+		if policy.MaxBackoffSec > 0 && sec >= policy.MaxBackoffSec {
+			break
+		}
+	}
+	if policy.MaxBackoffSec > 0 && sec > policy.MaxBackoffSec {
+		sec = policy.MaxBackoffSec
+	}
+	return time.Duration(sec * float64(time.Second))
 }
 
-func (j *coordinatorJob) cancel() {
-	if j.cancelFunc != nil {
-		j.cancelFunc()
-		log.Printf("[%v]ジョブのキャンセルリクエストを行ました", j.id)
+// finishAttempt 現在の試行の結果を記録し、試行したTaskRunnerとこれまでの試行回数を返す
+func (j *coordinatorJob) finishAttempt(index int, status string, err error) (string, int) {
+	j.taskInfosLock.Lock()
+	info := &j.taskInfos[index]
+	if len(info.attempts) > 0 {
+		attempt := &info.attempts[len(info.attempts)-1]
+		now := time.Now()
+		attempt.Status = status
+		attempt.FinishedAt = &now
+		if err != nil {
+			attempt.Error = err.Error()
+		}
 	}
+	runnerAddr, attemptNum := info.runnderAddr, len(info.attempts)
+	j.taskInfosLock.Unlock()
+
+	j.save()
+	return runnerAddr, attemptNum
 }
 
-func (j *coordinatorJob) getStatus() JobStatusResponse {
+// setTaskError 実行を完了できなかったタスクを失敗として記録する
+func (j *coordinatorJob) setTaskError(index int, reason, message string) {
 	j.taskInfosLock.Lock()
-	taskInfosCopy := make([]taskInfo, len(j.taskInfos))
-	copy(taskInfosCopy, j.taskInfos)
+	j.taskInfos[index].err = message
+	j.taskInfos[index].reason = reason
+	j.setTaskStateLocked(index, TaskStateFailed)
 	j.taskInfosLock.Unlock()
+	j.save()
+	j.logger.Printf("タスクを完了できませんでした Reason:%v %v\n", reason, message)
+}
 
-	response := JobStatusResponse{}
+// notifyTaskDone TaskRunnerからのタスク完了通知を受け取る
+// タスク開始リクエストの応答より先に完了通知が届く場合もあるため、タスク開始中は受け取り先がなければ作成して保持しておく
+// 監視しておらず開始中でもないタスクの通知は、すでに完了を確認したものか不明なものなので無視する
+// 実行中の状態が届いた場合は進捗の通知として状態を保持する
+func (j *coordinatorJob) notifyTaskDone(status TaskStatusResponse) {
+	if status.Status == StatusBusy {
+		j.cacheTaskProgress(status)
+		return
+	}
 
-	var statuses []TaskStatusResponse
+	j.callbacksLock.Lock()
+	callback, ok := j.callbacks[status.ID]
+	if !ok && j.startingNum > 0 {
+		callback = &taskCallback{done: make(chan struct{})}
+		j.callbacks[status.ID] = callback
+	}
+	j.callbacksLock.Unlock()
+	if callback == nil {
+		return
+	}
 
-	for _, taskInfo := range taskInfosCopy {
-		status, err := getTaskStatus(taskInfo.runnderAddr, taskInfo.id)
-		if err != nil {
-			log.Println(err)
+	callback.once.Do(func() {
+		callback.status = status
+		close(callback.done)
+	})
+}
+
+// watchTaskCallback 開始したタスクの完了通知の受け取り先を監視対象として取得する。なければ作成する
+func (j *coordinatorJob) watchTaskCallback(taskID string) *taskCallback {
+	j.callbacksLock.Lock()
+	defer j.callbacksLock.Unlock()
+
+	callback, ok := j.callbacks[taskID]
+	if !ok {
+		callback = &taskCallback{done: make(chan struct{})}
+		j.callbacks[taskID] = callback
+	}
+	callback.watched = true
+	return callback
+}
+
+func (j *coordinatorJob) removeTaskCallback(taskID string) {
+	j.callbacksLock.Lock()
+	defer j.callbacksLock.Unlock()
+	delete(j.callbacks, taskID)
+}
+
+// beginTaskStart タスク開始リクエストを送る前に呼び出し、応答より先に届く完了通知を受け取れるようにする
+func (j *coordinatorJob) beginTaskStart() {
+	j.callbacksLock.Lock()
+	defer j.callbacksLock.Unlock()
+	j.startingNum++
+}
+
+// endTaskStart タスク開始リクエストの応答を受け取った後に呼び出す
+// 開始中のタスクがなくなった時点で、監視対象にならなかった受け取り先を削除する
+func (j *coordinatorJob) endTaskStart() {
+	j.callbacksLock.Lock()
+	defer j.callbacksLock.Unlock()
+
+	j.startingNum--
+	if j.startingNum > 0 {
+		return
+	}
+	for taskID, callback := range j.callbacks {
+		if !callback.watched {
+			delete(j.callbacks, taskID)
+		}
+	}
+}
+
+// save ジョブ情報をJobStoreに保存する。JobStoreが指定されていない場合や削除済みの場合は何もしない
+// 保存中に呼び出された場合は保存が必要なことだけを記録して戻り、保存中の呼び出し元がまとめて最新の情報を保存する
+func (j *coordinatorJob) save() {
+	if j.store == nil {
+		return
+	}
+
+	j.saveLock.Lock()
+	j.saveDirty = true
+	if j.saving {
+		j.saveLock.Unlock()
+		return
+	}
+	j.saving = true
+	for j.saveDirty {
+		j.saveDirty = false
+		j.saveLock.Unlock()
+		j.write()
+		j.saveLock.Lock()
+	}
+	j.saving = false
+	j.saveLock.Unlock()
+}
+
+// write 現在のジョブ情報をJobStoreに書き込む。削除済みの場合は何もしない
+func (j *coordinatorJob) write() {
+	j.writeLock.Lock()
+	defer j.writeLock.Unlock()
+	if j.deleted {
+		return
+	}
+
+	if err := j.store.SaveJob(j.record()); err != nil {
+		j.logger.Printf("ジョブ情報の保存に失敗しました:%v", err)
+	}
+}
+
+// delete ジョブ情報をJobStoreから削除する。以降はsaveを呼び出しても保存されない
+func (j *coordinatorJob) delete() error {
+	j.writeLock.Lock()
+	defer j.writeLock.Unlock()
+
+	j.deleted = true
+	if j.store == nil {
+		return nil
+	}
+	return j.store.DeleteJob(j.id)
+}
+
+func (j *coordinatorJob) record() JobRecord {
+	j.taskInfosLock.Lock()
+	defer j.taskInfosLock.Unlock()
+
+	tasks := make([]TaskRecord, len(j.taskInfos))
+	for i, info := range j.taskInfos {
+		tasks[i] = TaskRecord{State: info.state, ID: info.id, RunnerAddr: info.runnderAddr, Error: info.err, Reason: info.reason, Attempts: copyAttempts(info.attempts), ResultValues: info.resultValues,
+			LastStatus: info.lastStatus, StatusUpdatedAt: info.statusUpdatedAt, LastError: info.lastError}
+	}
+	transitions := make([]JobStateTransition, len(j.transitions))
+	copy(transitions, j.transitions)
+	return JobRecord{ID: j.id, Request: j.req, Tasks: tasks, Completed: isJobStateFinished(j.state), Cancelled: j.cancelled, TimedOut: j.timedOut, State: j.state, Transitions: transitions}
+}
+
+func copyAttempts(attempts []TaskAttempt) []TaskAttempt {
+	if attempts == nil {
+		return nil
+	}
+	copied := make([]TaskAttempt, len(attempts))
+	copy(copied, attempts)
+	return copied
+}
+
+// cancel ジョブのキャンセルを記録し、実行中のタスクへキャンセルをリクエストする
+// キャンセルはジョブに記録されるため、実行開始前にキャンセルした場合も割り当て待ちのタスクは開始されない
+// 終了済みのジョブはキャンセル済みとして記録しない
+func (j *coordinatorJob) cancel(cod *Coordinator) JobCancelResponse {
+	response := JobCancelResponse{Cancelled: []JobCancelTask{}, AlreadyFinished: []JobCancelTask{}, Failed: []JobCancelTask{}}
+
+	type runningTask struct {
+		JobCancelTask
+		runnerAddr string
+	}
+	var runningTasks []runningTask
+
+	j.taskInfosLock.Lock()
+	for i := range j.taskInfos {
+		info := &j.taskInfos[i]
+		task := JobCancelTask{Index: i, ID: j.req.Tasks[i].ID, TaskID: info.id}
+		switch {
+		case isTaskStateFinished(info.state) || info.err != "":
+			response.AlreadyFinished = append(response.AlreadyFinished, task)
+		case info.state == TaskStateRunning && !info.cancelRequested:
+			info.cancelRequested = true
+			runningTasks = append(runningTasks, runningTask{JobCancelTask: task, runnerAddr: info.runnderAddr})
+		default:
+			response.Cancelled = append(response.Cancelled, task)
+		}
+	}
+	finished := isJobStateFinished(j.state)
+	if !finished {
+		j.cancelled = true
+		if j.cancelFunc != nil {
+			j.cancelFunc()
+		}
+	}
+	j.taskInfosLock.Unlock()
+
+	if finished {
+		return response
+	}
+	j.save()
+	log.Printf("[%v]ジョブのキャンセルリクエストを行いました", j.id)
+
+	// 実行中のタスクへのキャンセルリクエストは並行して行う
+	errs := make([]error, len(runningTasks))
+	var wg sync.WaitGroup
+	for i, task := range runningTasks {
+		wg.Add(1)
+		go func(i int, runnerAddr, taskID string) {
+			defer wg.Done()
+			errs[i] = cod.cancelRunnerTask(runnerAddr, taskID)
+		}(i, task.runnerAddr, task.TaskID)
+	}
+	wg.Wait()
+
+	for i, task := range runningTasks {
+		if errs[i] != nil {
+			j.logger.Printf("TaskRunner %v で開始したTaskID %v へのキャンセルに失敗しました。 %v", task.runnerAddr, task.TaskID, errs[i])
+			task.Error = errs[i].Error()
+			response.Failed = append(response.Failed, task.JobCancelTask)
 		} else {
-			statuses = append(statuses, status)
+			response.Cancelled = append(response.Cancelled, task.JobCancelTask)
 		}
 	}
+	return response
+}
+
+// addRunningTasks 実行中のタスクを実行しているTaskRunnerごとに追加する
+func (j *coordinatorJob) addRunningTasks(tasks map[string][]RunnerTask) {
+	j.taskInfosLock.Lock()
+	defer j.taskInfosLock.Unlock()
+
+	for i, info := range j.taskInfos {
+		if info.state == TaskStateRunning {
+			tasks[info.runnderAddr] = append(tasks[info.runnderAddr], RunnerTask{JobID: j.id, TaskIndex: i, TaskID: info.id})
+		}
+	}
+}
 
-	response.Busy = j.busy
+// getStatus ジョブの状態を取得する
+// タスクの状態は監視中に取得して保持しているものを返すため、TaskRunnerへの問い合わせは行わない
+func (j *coordinatorJob) getStatus() JobStatusResponse {
+	j.taskInfosLock.Lock()
+	defer j.taskInfosLock.Unlock()
+
+	response := JobStatusResponse{State: j.state, Busy: !isJobStateFinished(j.state)}
+	response.Transitions = make([]JobStateTransition, len(j.transitions))
+	copy(response.Transitions, j.transitions)
+
+	statuses := []TaskStatusResponse{}
+	now := time.Now()
+	var progressSum float64
+	for i, info := range j.taskInfos {
+		taskReq := j.req.Tasks[i]
+		taskStatus := JobTaskStatus{Index: i, ID: taskReq.ID, ProcName: taskReq.ProcName, DependsOn: taskReq.DependsOn, State: info.state,
+			Attempts: copyAttempts(info.attempts), LastError: info.lastError, Progress: info.progress()}
+		progressSum += taskStatus.Progress
+
+		if info.lastStatus != nil {
+			lastStatus := *info.lastStatus
+			updatedAt := *info.statusUpdatedAt
+			taskStatus.LastStatus = &lastStatus
+			taskStatus.StatusUpdatedAt = &updatedAt
+			taskStatus.StatusAgeSec = now.Sub(updatedAt).Seconds()
+			statuses = append(statuses, lastStatus)
+		}
+		response.Tasks = append(response.Tasks, taskStatus)
+
+		if info.err != "" {
+			response.TaskErrors = append(response.TaskErrors, JobTaskError{Index: i, ProcName: taskReq.ProcName, Reason: info.reason, Error: info.err})
+		}
+	}
 	response.TaskStatuses = &statuses
+	if len(j.taskInfos) > 0 {
+		response.Progress = progressSum / float64(len(j.taskInfos))
+	}
 
 	return response
 }
+
+// progress タスクの進捗を0から1までの値で求める
+// 終了したタスクは1、実行中のタスクは最後に取得できた進捗、それ以外は0とする
+func (info *taskInfo) progress() float64 {
+	if isTaskStateFinished(info.state) || info.err != "" {
+		return 1
+	}
+	if info.state == TaskStateRunning && info.lastStatus != nil && info.lastStatus.Progress != nil {
+		return info.lastStatus.Progress.Fraction
+	}
+	return 0
+}
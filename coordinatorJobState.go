@@ -0,0 +1,134 @@
+package gojobcoordinatortest
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// isTaskStateFinished 終了した状態かを調べる
+func isTaskStateFinished(state string) bool {
+	switch state {
+	case TaskStateSucceeded, TaskStateFailed, TaskStateSkipped, TaskStateCancelled, TaskStateTimedOut:
+		return true
+	}
+	return false
+}
+
+// isJobStateFinished 終了した状態かを調べる
+func isJobStateFinished(state string) bool {
+	switch state {
+	case JobStateSucceeded, JobStateFailed, JobStatePartiallyFailed, JobStateCancelled, JobStateTimedOut:
+		return true
+	}
+	return false
+}
+
+// computeJobState ジョブ内タスクの状態からジョブの状態を求める
+// startedはジョブの実行が開始されているか、cancelledはキャンセルが要求されているか、timedOutはジョブの制限時間を過ぎたかを表す
+func computeJobState(taskStates []string, started, cancelled, timedOut bool) string {
+	if !started {
+		return JobStatePending
+	}
+
+	var finishedNum, succeededNum, failedNum, cancelledNum, timedOutNum, runningNum, pendingNum int
+	for _, state := range taskStates {
+		if isTaskStateFinished(state) {
+			finishedNum++
+		}
+		switch state {
+		case TaskStateSucceeded:
+			succeededNum++
+		case TaskStateFailed:
+			failedNum++
+		case TaskStateCancelled:
+			cancelledNum++
+		case TaskStateTimedOut:
+			timedOutNum++
+		case TaskStateRunning:
+			runningNum++
+		case TaskStatePending:
+			pendingNum++
+		}
+	}
+
+	if finishedNum < len(taskStates) {
+		// 実行中のタスクがなく、割り当て待ちのタスクがある場合はTaskRunnerの空きを待っている
+		if runningNum == 0 && pendingNum > 0 {
+			return JobStateWaitingForRunner
+		}
+		return JobStateRunning
+	}
+
+	switch {
+	case succeededNum == len(taskStates):
+		return JobStateSucceeded
+	case cancelled:
+		return JobStateCancelled
+	case timedOut:
+		return JobStateTimedOut
+	case succeededNum > 0:
+		return JobStatePartiallyFailed
+	// 成功したタスクがなく、失敗ではなくキャンセルか制限時間切れで終わったタスクだけの場合はその状態とする
+	case failedNum == 0 && timedOutNum == 0 && cancelledNum > 0:
+		return JobStateCancelled
+	case failedNum == 0 && cancelledNum == 0 && timedOutNum > 0:
+		return JobStateTimedOut
+	default:
+		return JobStateFailed
+	}
+}
+
+// updateStateLocked タスクの状態からジョブの状態を更新し、変化していれば遷移を記録する
+// taskInfosLockを取得した状態で呼び出す
+func (j *coordinatorJob) updateStateLocked() {
+	taskStates := make([]string, len(j.taskInfos))
+	for i, info := range j.taskInfos {
+		taskStates[i] = info.state
+	}
+
+	state := computeJobState(taskStates, j.started, j.cancelled, j.timedOut)
+	if state == j.state {
+		return
+	}
+
+	j.state = state
+	j.transitions = append(j.transitions, JobStateTransition{State: state, Time: time.Now()})
+}
+
+// setTaskStateLocked タスクの状態を更新し、ジョブの状態に反映する
+// taskInfosLockを取得した状態で呼び出す
+func (j *coordinatorJob) setTaskStateLocked(index int, state string) {
+	j.taskInfos[index].state = state
+	j.updateStateLocked()
+}
+
+// abortTask ジョブのキャンセルか制限時間により終了したタスクの状態を記録する
+func (j *coordinatorJob) abortTask(ctx context.Context, index int) {
+	j.taskInfosLock.Lock()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		j.timedOut = true
+		j.setTaskStateLocked(index, TaskStateTimedOut)
+	} else {
+		j.setTaskStateLocked(index, TaskStateCancelled)
+	}
+	j.taskInfosLock.Unlock()
+	j.save()
+}
+
+func (j *coordinatorJob) setTaskState(index int, state string) {
+	j.taskInfosLock.Lock()
+	j.setTaskStateLocked(index, state)
+	j.taskInfosLock.Unlock()
+	j.save()
+}
+
+// getState ジョブの状態と遷移履歴を取得する
+func (j *coordinatorJob) getState() (string, []JobStateTransition) {
+	j.taskInfosLock.Lock()
+	defer j.taskInfosLock.Unlock()
+
+	transitions := make([]JobStateTransition, len(j.transitions))
+	copy(transitions, j.transitions)
+	return j.state, transitions
+}
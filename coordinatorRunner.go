@@ -0,0 +1,172 @@
+package gojobcoordinatortest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// runnerInfo Coordinatorに接続しているTaskRunnerの情報
+// procsはTaskRunnerが実行可能な処理名。取得できていない場合はnilとなり、全処理を実行可能とみなす
+// labelsにはTaskRunnerに設定されたラベル、versionにはTaskRunnerのバージョン、schemasには処理名ごとのパラメータのスキーマが入る
+// lastSeenには生存通知を受け取るか生存確認に成功した最後の時刻、healthCheckFailuresには生存確認が連続で失敗した回数が入る
+// stateにはRunnerState〜の値が入る
+type runnerInfo struct {
+	addr                string
+	lock                sync.Mutex
+	activeTaskNum       uint
+	taskNumMax          uint
+	procs               map[string]bool
+	labels              map[string]string
+	schemas             map[string]*ParamsSchema
+	version             string
+	connectedAt         time.Time
+	lastSeen            time.Time
+	healthCheckFailures int
+	state               string
+}
+
+func newRunnerInfo(addr string) *runnerInfo {
+	now := time.Now()
+	return &runnerInfo{addr: addr, connectedAt: now, lastSeen: now, state: RunnerStateActive}
+}
+
+// status 指定した実行中タスクを含めてTaskRunnerの状態を作成する
+func (info *runnerInfo) status(tasks []RunnerTask) RunnerStatus {
+	info.lock.Lock()
+	defer info.lock.Unlock()
+
+	var procs []string
+	for procName := range info.procs {
+		procs = append(procs, procName)
+	}
+	sort.Strings(procs)
+
+	labels := make(map[string]string, len(info.labels))
+	for key, value := range info.labels {
+		labels[key] = value
+	}
+
+	if tasks == nil {
+		tasks = []RunnerTask{}
+	}
+	return RunnerStatus{Address: info.addr, State: info.state, ConnectedAt: info.connectedAt, LastHealthyAt: info.lastSeen, HealthCheckFailures: info.healthCheckFailures,
+		Version: info.version, Procs: procs, Labels: labels, ActiveTaskNum: info.activeTaskNum, TaskNumMax: info.taskNumMax, Tasks: tasks}
+}
+
+func (info *runnerInfo) getState() string {
+	info.lock.Lock()
+	defer info.lock.Unlock()
+	return info.state
+}
+
+func (info *runnerInfo) setState(state string) {
+	info.lock.Lock()
+	info.state = state
+	info.lock.Unlock()
+}
+
+func (info *runnerInfo) load() RunnerLoad {
+	info.lock.Lock()
+	defer info.lock.Unlock()
+
+	return RunnerLoad{Address: info.addr, ActiveTaskNum: info.activeTaskNum, TaskNumMax: info.taskNumMax}
+}
+
+func (info *runnerInfo) addActiveTaskNum(delta int) {
+	info.lock.Lock()
+	defer info.lock.Unlock()
+
+	if delta < 0 && uint(-delta) > info.activeTaskNum {
+		info.activeTaskNum = 0
+		return
+	}
+	info.activeTaskNum = uint(int(info.activeTaskNum) + delta)
+}
+
+// supports 指定した処理名のタスクを実行可能かを調べる
+func (info *runnerInfo) supports(procName string) bool {
+	info.lock.Lock()
+	defer info.lock.Unlock()
+
+	if info.procs == nil {
+		return true
+	}
+	return info.procs[procName]
+}
+
+// paramsSchema 指定した処理名のパラメータのスキーマを取得する
+// スキーマが登録されていない場合はnilを返す
+func (info *runnerInfo) paramsSchema(procName string) *ParamsSchema {
+	info.lock.Lock()
+	defer info.lock.Unlock()
+
+	return info.schemas[procName]
+}
+
+// matches TaskRunnerのラベルが指定した条件に一致するかを調べる
+func (info *runnerInfo) matches(selector LabelSelector) bool {
+	info.lock.Lock()
+	defer info.lock.Unlock()
+
+	return selector.Matches(info.labels)
+}
+
+// update TaskRunnerから実行可能な処理名、ラベル、負荷状況を取得して反映する
+func (info *runnerInfo) update(client TaskRunnerClient) error {
+	runnerInfo, err := client.Info(context.Background())
+	if err != nil {
+		return fmt.Errorf("TaskRunnerの情報取得に失敗しました:%s", err.Error())
+	}
+
+	info.setInfo(runnerInfo)
+	return nil
+}
+
+// setInfo TaskRunnerから取得した情報を反映する
+func (info *runnerInfo) setInfo(runnerInfo TaskRunnerInfoResponse) {
+	procs := make(map[string]bool, len(runnerInfo.Procs))
+	for _, procName := range runnerInfo.Procs {
+		procs[procName] = true
+	}
+
+	info.lock.Lock()
+	info.procs = procs
+	info.labels = runnerInfo.Labels
+	info.schemas = runnerInfo.Schemas
+	info.version = runnerInfo.Version
+	info.activeTaskNum = runnerInfo.ActiveTaskNum
+	info.taskNumMax = runnerInfo.TaskNumMax
+	info.lock.Unlock()
+}
+
+func (info *runnerInfo) setStats(stats TaskRunnerStatsResponse) {
+	info.lock.Lock()
+	info.activeTaskNum = stats.ActiveTaskNum
+	info.taskNumMax = stats.TaskNumMax
+	info.lock.Unlock()
+}
+
+// touch TaskRunnerの生存を確認した時刻を記録する
+func (info *runnerInfo) touch() {
+	info.lock.Lock()
+	info.lastSeen = time.Now()
+	info.healthCheckFailures = 0
+	info.lock.Unlock()
+}
+
+// healthCheckFailed 生存確認に失敗した回数を記録する
+func (info *runnerInfo) healthCheckFailed() {
+	info.lock.Lock()
+	info.healthCheckFailures++
+	info.lock.Unlock()
+}
+
+// expired 最後に生存を確認してからtimeoutを過ぎているかを調べる
+func (info *runnerInfo) expired(timeout time.Duration) bool {
+	info.lock.Lock()
+	defer info.lock.Unlock()
+	return time.Since(info.lastSeen) > timeout
+}
@@ -3,6 +3,7 @@ package gojobcoordinatortest
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -34,7 +35,13 @@ func (codServer *CoordinatorServer) NewHTTPHandler() http.Handler {
 
 		startResp, err := codServer.cod.Start(startReq)
 		if err != nil {
-			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			statusCode := http.StatusInternalServerError
+			var reqErr *JobRequestError
+			if errors.As(err, &reqErr) {
+				statusCode = http.StatusBadRequest
+			}
+			http.Error(rw, err.Error(), statusCode)
+			return
 		}
 
 		err = json.NewEncoder(rw).Encode(startResp)
@@ -48,11 +55,20 @@ func (codServer *CoordinatorServer) NewHTTPHandler() http.Handler {
 	r.HandleFunc("/cancel/{jobID}", func(rw http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 
-		err := codServer.cod.Cancel(vars["jobID"])
+		cancelResp, err := codServer.cod.Cancel(vars["jobID"])
 		if err != nil {
-			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			statusCode := http.StatusInternalServerError
+			if errors.Is(err, ErrJobNotFound) {
+				statusCode = http.StatusNotFound
+			}
+			http.Error(rw, err.Error(), statusCode)
 			return
 		}
+
+		err = json.NewEncoder(rw).Encode(cancelResp)
+		if err != nil {
+			http.Error(rw, fmt.Sprint("レスポンス作成に失敗しました:", err.Error()), http.StatusInternalServerError)
+		}
 	}).Methods("POST")
 
 	// ジョブステータス取得
@@ -61,7 +77,12 @@ func (codServer *CoordinatorServer) NewHTTPHandler() http.Handler {
 
 		jobStatusResp, err := codServer.cod.GetStatus(vars["jobID"])
 		if err != nil {
-			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			statusCode := http.StatusInternalServerError
+			if errors.Is(err, ErrJobNotFound) {
+				statusCode = http.StatusNotFound
+			}
+			http.Error(rw, err.Error(), statusCode)
+			return
 		}
 
 		err = json.NewEncoder(rw).Encode(jobStatusResp)
@@ -71,6 +92,23 @@ func (codServer *CoordinatorServer) NewHTTPHandler() http.Handler {
 
 	}).Methods("GET")
 
+	// TaskRunnerからのタスク完了通知
+	r.HandleFunc("/callback/{jobID}", func(rw http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		vars := mux.Vars(r)
+
+		var status TaskStatusResponse
+		if !ReadJSONFromRequest(rw, r, &status) {
+			return
+		}
+
+		err := codServer.cod.NotifyTaskDone(vars["jobID"], status)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusNotFound)
+			return
+		}
+	}).Methods("POST")
+
 	// TaskRunner接続
 	r.HandleFunc("/connect", func(rw http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
@@ -105,6 +143,73 @@ func (codServer *CoordinatorServer) NewHTTPHandler() http.Handler {
 
 	}).Methods("POST")
 
+	// TaskRunnerからの登録
+	r.HandleFunc("/register", func(rw http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		var registerReq TaskRunnerRegisterRequest
+		if !ReadJSONFromRequest(rw, r, &registerReq) {
+			return
+		}
+
+		err := codServer.cod.Register(registerReq)
+		if errors.Is(err, ErrRunnerDrained) {
+			// 退避済みの場合は409を返し、TaskRunnerに再登録を控えさせる
+			http.Error(rw, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}).Methods("POST")
+
+	// TaskRunnerからの生存通知
+	r.HandleFunc("/heartbeat", func(rw http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		var heartbeatReq TaskRunnerHeartbeatRequest
+		if !ReadJSONFromRequest(rw, r, &heartbeatReq) {
+			return
+		}
+
+		responseData, err := codServer.cod.Heartbeat(heartbeatReq)
+		if err != nil {
+			// 未登録の場合は404を返し、TaskRunnerに再登録させる
+			http.Error(rw, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		err = json.NewEncoder(rw).Encode(responseData)
+		if err != nil {
+			http.Error(rw, fmt.Sprint("レスポンス作成に失敗しました:", err.Error()), http.StatusInternalServerError)
+		}
+	}).Methods("POST")
+
+	// TaskRunnerへの割り当て停止・再開・退避
+	runnerOperations := map[string]func(TaskRunnerConnectionRequest) error{
+		"/cordon":   codServer.cod.Cordon,
+		"/uncordon": codServer.cod.Uncordon,
+		"/drain":    codServer.cod.Drain,
+	}
+	for path, operation := range runnerOperations {
+		operation := operation
+		r.HandleFunc(path, func(rw http.ResponseWriter, r *http.Request) {
+			defer r.Body.Close()
+
+			var connectionReq TaskRunnerConnectionRequest
+			if !ReadJSONFromRequest(rw, r, &connectionReq) {
+				return
+			}
+
+			err := operation(connectionReq)
+			if err != nil {
+				http.Error(rw, err.Error(), http.StatusNotFound)
+				return
+			}
+		}).Methods("POST")
+	}
+
 	// 接続しているRunner取得
 	r.HandleFunc("/runners", func(rw http.ResponseWriter, r *http.Request) {
 		responseData := codServer.cod.GetRunners()
@@ -114,6 +219,23 @@ func (codServer *CoordinatorServer) NewHTTPHandler() http.Handler {
 		}
 	}).Methods("GET")
 
+	// ジョブ削除
+	r.HandleFunc("/jobs/{jobID}", func(rw http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		err := codServer.cod.DeleteJob(vars["jobID"])
+		if err != nil {
+			statusCode := http.StatusInternalServerError
+			if errors.Is(err, ErrJobNotFound) {
+				statusCode = http.StatusNotFound
+			} else if errors.Is(err, ErrJobNotFinished) {
+				statusCode = http.StatusConflict
+			}
+			http.Error(rw, err.Error(), statusCode)
+			return
+		}
+	}).Methods("DELETE")
+
 	// ジョブ一覧取得
 	r.HandleFunc("/jobs", func(rw http.ResponseWriter, r *http.Request) {
 		responseData := codServer.cod.GetJobs()
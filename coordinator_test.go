@@ -0,0 +1,1248 @@
+package gojobcoordinatortest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/y-akahori-ramen/gojobcoordinatortest"
+	"github.com/y-akahori-ramen/gojobcoordinatortest/client"
+)
+
+const (
+	testProcName      = "TestEcho"
+	testFlakyProcName = "TestFlaky"
+	testWaitProcName  = "TestWait"
+)
+
+// testEchoTask パラメータをそのまま結果値として返すタスク
+type testEchoTask struct {
+	params *map[string]interface{}
+}
+
+func (task *testEchoTask) Run(ctx context.Context, taskID string, logger *log.Logger, done chan<- *gojobcoordinatortest.TaskResult) {
+	done <- &gojobcoordinatortest.TaskResult{ID: taskID, Success: true, ResultValues: task.params}
+}
+
+func newTestEchoTask(req *gojobcoordinatortest.TaskStartRequest) (gojobcoordinatortest.Task, error) {
+	if req.Params != nil {
+		if _, ok := (*req.Params)["Invalid"]; ok {
+			return nil, errors.New("パラメータが不正です")
+		}
+	}
+	return &testEchoTask{params: req.Params}, nil
+}
+
+// testFlakyTask 初回の実行のみ失敗するタスク
+type testFlakyTask struct {
+	runCount *int32
+}
+
+func (task *testFlakyTask) Run(ctx context.Context, taskID string, logger *log.Logger, done chan<- *gojobcoordinatortest.TaskResult) {
+	success := atomic.AddInt32(task.runCount, 1) > 1
+	done <- &gojobcoordinatortest.TaskResult{ID: taskID, Success: success}
+}
+
+// testWaitTask キャンセルされるまで待機するタスク
+// パラメータWaitSecで待機時間を指定できる。指定しない場合は10秒待機すると成功する
+type testWaitTask struct {
+	duration time.Duration
+}
+
+func (task *testWaitTask) Run(ctx context.Context, taskID string, logger *log.Logger, done chan<- *gojobcoordinatortest.TaskResult) {
+	select {
+	case <-ctx.Done():
+		done <- &gojobcoordinatortest.TaskResult{ID: taskID, Success: false}
+	case <-time.After(task.duration):
+		done <- &gojobcoordinatortest.TaskResult{ID: taskID, Success: true}
+	}
+}
+
+func newTestWaitTask(req *gojobcoordinatortest.TaskStartRequest) (gojobcoordinatortest.Task, error) {
+	task := &testWaitTask{duration: time.Second * 10}
+	if req.Params != nil {
+		if sec, ok := (*req.Params)["WaitSec"].(float64); ok {
+			task.duration = time.Duration(sec * float64(time.Second))
+		}
+	}
+	return task, nil
+}
+
+// newTestRunnerServer テスト用のTaskRunnerサーバーを起動する
+func newTestRunnerServer(t *testing.T, ctx context.Context) *httptest.Server {
+	return newTestRunnerServerWithConfig(t, ctx, gojobcoordinatortest.TaskRunnerConfig{TaskNumMax: 2})
+}
+
+// newTestRunnerServerWithConfig 設定を指定してテスト用のTaskRunnerサーバーを起動する
+func newTestRunnerServerWithConfig(t *testing.T, ctx context.Context, config gojobcoordinatortest.TaskRunnerConfig) *httptest.Server {
+	runner := gojobcoordinatortest.NewTaskRunner(config)
+	runner.AddFactory(testProcName, newTestEchoTask)
+	runner.AddFactory(testWaitProcName, newTestWaitTask)
+	var flakyRunCount int32
+	runner.AddFactory(testFlakyProcName, func(req *gojobcoordinatortest.TaskStartRequest) (gojobcoordinatortest.Task, error) {
+		return &testFlakyTask{runCount: &flakyRunCount}, nil
+	})
+
+	server := gojobcoordinatortest.NewTaskRunnerServer(runner)
+	go server.Run(ctx)
+
+	httpServer := httptest.NewServer(server.NewHTTPHandler())
+	t.Cleanup(httpServer.Close)
+	return httpServer
+}
+
+// newTestCoordinatorServer テスト用のCoordinatorサーバーを起動する
+func newTestCoordinatorServer(t *testing.T, ctx context.Context, config gojobcoordinatortest.CoordinatorConfig) (*gojobcoordinatortest.Coordinator, *httptest.Server) {
+	return newTestCoordinatorServerWithListener(t, ctx, config, nil)
+}
+
+// newTestCoordinatorServerWithListener 待ち受けるListenerを指定してテスト用のCoordinatorサーバーを起動する
+// listenerがnilの場合は空いているポートで待ち受ける
+func newTestCoordinatorServerWithListener(t *testing.T, ctx context.Context, config gojobcoordinatortest.CoordinatorConfig, listener net.Listener) (*gojobcoordinatortest.Coordinator, *httptest.Server) {
+	httpServer := httptest.NewUnstartedServer(nil)
+	if listener != nil {
+		httpServer.Listener.Close()
+		httpServer.Listener = listener
+	}
+	if config.CallbackBaseURL == "" {
+		config.CallbackBaseURL = "http://" + httpServer.Listener.Addr().String()
+	}
+
+	cod := gojobcoordinatortest.NewCoordinator(config)
+	server := gojobcoordinatortest.NewCoordinatorServer(cod)
+	go server.Run(ctx)
+
+	httpServer.Config.Handler = server.NewHTTPHandler()
+	httpServer.Start()
+	t.Cleanup(httpServer.Close)
+	return cod, httpServer
+}
+
+// newTestJobTasks 指定した処理名のタスクを並べたジョブのタスク一覧を作成する
+func newTestJobTasks(procNames ...string) []gojobcoordinatortest.JobTaskRequest {
+	var tasks []gojobcoordinatortest.JobTaskRequest
+	for _, procName := range procNames {
+		tasks = append(tasks, gojobcoordinatortest.JobTaskRequest{TaskStartRequest: gojobcoordinatortest.TaskStartRequest{ProcName: procName}})
+	}
+	return tasks
+}
+
+// waitJobComplete taskNum個のタスクを持つジョブが終了するまで待つ
+func waitJobComplete(t *testing.T, cod *gojobcoordinatortest.Coordinator, jobID string, taskNum int, timeout time.Duration) gojobcoordinatortest.JobStatusResponse {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		status, err := cod.GetStatus(jobID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(status.Tasks) != taskNum {
+			t.Fatalf("%d != %d", len(status.Tasks), taskNum)
+		}
+		if status.State != gojobcoordinatortest.JobStatePending && !status.Busy {
+			return status
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+	t.Fatalf("ジョブ %v が %v 以内に完了しませんでした", jobID, timeout)
+	return gojobcoordinatortest.JobStatusResponse{}
+}
+
+// waitJobState ジョブが指定した状態になるまで待つ
+func waitJobState(t *testing.T, cod *gojobcoordinatortest.Coordinator, jobID, state string, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		status, err := cod.GetStatus(jobID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.State == state {
+			return
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+	t.Fatalf("ジョブ %v が %v 以内に %v になりませんでした", jobID, timeout, state)
+}
+
+func TestCoordinatorCallback(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runnerServer := newTestRunnerServer(t, ctx)
+	cod, _ := newTestCoordinatorServer(t, ctx, gojobcoordinatortest.CoordinatorConfig{})
+
+	if err := cod.Connect(gojobcoordinatortest.TaskRunnerConnectionRequest{Address: runnerServer.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := cod.Start(gojobcoordinatortest.JobStartRequest{
+		Tasks: newTestJobTasks(testProcName, testProcName),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ポーリング間隔よりも十分短い時間で完了が確認できれば完了通知が使用されている
+	status := waitJobComplete(t, cod, resp.ID, 2, time.Second*5)
+	if status.State != gojobcoordinatortest.JobStateSucceeded {
+		t.Fatalf("unexpected job state %v", status.State)
+	}
+	if status.TaskStatuses == nil || len(*status.TaskStatuses) != 2 {
+		t.Fatalf("unexpected task statuses %v", status.TaskStatuses)
+	}
+	for _, taskStatus := range *status.TaskStatuses {
+		if taskStatus.Status != gojobcoordinatortest.StatusSuccess {
+			t.Fatalf("unexpected task status %v", taskStatus)
+		}
+	}
+}
+
+func TestCoordinatorStatusCache(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runnerServer := newTestRunnerServer(t, ctx)
+	cod, _ := newTestCoordinatorServer(t, ctx, gojobcoordinatortest.CoordinatorConfig{})
+
+	if err := cod.Connect(gojobcoordinatortest.TaskRunnerConnectionRequest{Address: runnerServer.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := cod.Start(gojobcoordinatortest.JobStartRequest{
+		Tasks: newTestJobTasks(testProcName, testProcName),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitJobComplete(t, cod, resp.ID, 2, time.Second*5)
+
+	// TaskRunnerが停止しても最後に取得できたタスクの状態が返される
+	if err := cod.Disconnect(gojobcoordinatortest.TaskRunnerConnectionRequest{Address: runnerServer.URL}); err != nil {
+		t.Fatal(err)
+	}
+	runnerServer.Close()
+
+	status, err := cod.GetStatus(resp.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.TaskStatuses == nil || len(*status.TaskStatuses) != 2 {
+		t.Fatalf("unexpected task statuses %v", status.TaskStatuses)
+	}
+	for _, task := range status.Tasks {
+		if task.LastStatus == nil || task.LastStatus.Status != gojobcoordinatortest.StatusSuccess {
+			t.Fatalf("unexpected last status %v", task.LastStatus)
+		}
+		if task.StatusUpdatedAt == nil || task.StatusAgeSec < 0 {
+			t.Fatalf("unexpected status updated time %v %v", task.StatusUpdatedAt, task.StatusAgeSec)
+		}
+	}
+}
+
+func TestCoordinatorUnschedulable(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runnerServer := newTestRunnerServer(t, ctx)
+	cod, _ := newTestCoordinatorServer(t, ctx, gojobcoordinatortest.CoordinatorConfig{})
+
+	if err := cod.Connect(gojobcoordinatortest.TaskRunnerConnectionRequest{Address: runnerServer.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := cod.Start(gojobcoordinatortest.JobStartRequest{
+		Tasks: newTestJobTasks(testProcName, "Unknown"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 対応するTaskRunnerがない処理は再試行せずに終了する
+	status := waitJobComplete(t, cod, resp.ID, 2, time.Second*5)
+	if len(status.TaskErrors) != 1 || status.TaskErrors[0].Index != 1 || status.TaskErrors[0].Reason != gojobcoordinatortest.TaskStartRejectUnschedulable {
+		t.Fatalf("unexpected task errors %v", status.TaskErrors)
+	}
+}
+
+func TestCoordinatorInvalidParams(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runnerServer := newTestRunnerServer(t, ctx)
+	cod, _ := newTestCoordinatorServer(t, ctx, gojobcoordinatortest.CoordinatorConfig{})
+
+	if err := cod.Connect(gojobcoordinatortest.TaskRunnerConnectionRequest{Address: runnerServer.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	params := map[string]interface{}{"Invalid": true}
+	tasks := newTestJobTasks(testProcName)
+	tasks[0].Params = &params
+	resp, err := cod.Start(gojobcoordinatortest.JobStartRequest{Tasks: tasks})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// パラメータの誤りは再試行せずに終了する
+	status := waitJobComplete(t, cod, resp.ID, 1, time.Second*5)
+	if len(status.TaskErrors) != 1 || status.TaskErrors[0].Reason != gojobcoordinatortest.TaskStartRejectInvalidParams {
+		t.Fatalf("unexpected task errors %v", status.TaskErrors)
+	}
+}
+
+func TestCoordinatorParamsSchema(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runner := gojobcoordinatortest.NewTaskRunner(gojobcoordinatortest.TaskRunnerConfig{TaskNumMax: 2})
+	err := gojobcoordinatortest.AddTypedTask(runner, testAddProc, func(ctx context.Context, taskID string, logger *log.Logger, params testAddParams) (testAddResult, error) {
+		return testAddResult{Sum: params.A + params.B}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runnerServer := httptest.NewServer(gojobcoordinatortest.NewTaskRunnerServer(runner).NewHTTPHandler())
+	defer runnerServer.Close()
+
+	cod, _ := newTestCoordinatorServer(t, ctx, gojobcoordinatortest.CoordinatorConfig{})
+	if err := cod.Connect(gojobcoordinatortest.TaskRunnerConnectionRequest{Address: runnerServer.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	newTask := func(id string, params map[string]interface{}, dependsOn ...string) gojobcoordinatortest.JobTaskRequest {
+		return gojobcoordinatortest.JobTaskRequest{ID: id, TaskStartRequest: gojobcoordinatortest.TaskStartRequest{ProcName: testAddProc.ProcName, Params: &params}, DependsOn: dependsOn}
+	}
+
+	// スキーマに一致しないパラメータはジョブ作成前にすべて報告される
+	_, err = cod.Start(gojobcoordinatortest.JobStartRequest{Tasks: []gojobcoordinatortest.JobTaskRequest{
+		newTask("first", map[string]interface{}{"a": "1", "b": 2}),
+		newTask("second", map[string]interface{}{"a": 1}),
+	}})
+	var reqErr *gojobcoordinatortest.JobRequestError
+	if !errors.As(err, &reqErr) || len(reqErr.Violations) != 2 {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if jobs := cod.GetJobs(); len(jobs.Summaries) != 0 {
+		t.Fatalf("unexpected jobs %v", jobs.Summaries)
+	}
+
+	// プレースホルダは解決後の値が分からないため検証しない
+	resp, err := cod.Start(gojobcoordinatortest.JobStartRequest{Tasks: []gojobcoordinatortest.JobTaskRequest{
+		newTask("first", map[string]interface{}{"a": 1, "b": 2}),
+		newTask("second", map[string]interface{}{"a": "${first.sum}", "b": 3}, "first"),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := waitJobComplete(t, cod, resp.ID, 2, time.Second*5)
+	if status.State != gojobcoordinatortest.JobStateSucceeded {
+		t.Fatalf("unexpected job status %v", status)
+	}
+}
+
+func TestCoordinatorProgress(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	finish := make(chan struct{})
+	runner := gojobcoordinatortest.NewTaskRunner(gojobcoordinatortest.TaskRunnerConfig{TaskNumMax: 2})
+	runner.AddFactory(testProcName, newTestEchoTask)
+	runner.AddFactory("TestProgress", newTestFuncTaskFactory(func(ctx context.Context, taskID string, done chan<- *gojobcoordinatortest.TaskResult) {
+		gojobcoordinatortest.ReportProgress(ctx, gojobcoordinatortest.TaskProgress{Fraction: 0.5, Message: "half"})
+		<-finish
+		done <- &gojobcoordinatortest.TaskResult{ID: taskID, Success: true}
+	}))
+	runnerServer := httptest.NewServer(gojobcoordinatortest.NewTaskRunnerServer(runner).NewHTTPHandler())
+	defer runnerServer.Close()
+
+	cod, _ := newTestCoordinatorServer(t, ctx, gojobcoordinatortest.CoordinatorConfig{})
+	if err := cod.Connect(gojobcoordinatortest.TaskRunnerConnectionRequest{Address: runnerServer.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := cod.Start(gojobcoordinatortest.JobStartRequest{Tasks: newTestJobTasks(testProcName, "TestProgress")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 完了したタスクと進捗を通知したタスクの平均がジョブの進捗となる
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		status, err := cod.GetStatus(resp.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Progress == 0.75 {
+			if status.Tasks[1].Progress != 0.5 || status.Tasks[1].LastStatus.Progress.Message != "half" {
+				t.Fatalf("unexpected task status %+v", status.Tasks[1])
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("進捗が反映されませんでした %+v", status)
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+
+	close(finish)
+	status := waitJobComplete(t, cod, resp.ID, 2, time.Second*5)
+	if status.State != gojobcoordinatortest.JobStateSucceeded || status.Progress != 1 {
+		t.Fatalf("unexpected job status %+v", status)
+	}
+}
+
+func TestCoordinatorRetry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runnerServer := newTestRunnerServer(t, ctx)
+	cod, _ := newTestCoordinatorServer(t, ctx, gojobcoordinatortest.CoordinatorConfig{})
+
+	if err := cod.Connect(gojobcoordinatortest.TaskRunnerConnectionRequest{Address: runnerServer.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := cod.Start(gojobcoordinatortest.JobStartRequest{
+		Tasks:       newTestJobTasks(testFlakyProcName),
+		RetryPolicy: &gojobcoordinatortest.RetryPolicy{MaxAttempts: 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 1回目は失敗し、2回目の試行で成功する
+	status := waitJobComplete(t, cod, resp.ID, 1, time.Second*5)
+	attempts := status.Tasks[0].Attempts
+	if len(attempts) != 2 || attempts[0].Status != gojobcoordinatortest.StatusFailure || attempts[1].Status != gojobcoordinatortest.StatusSuccess {
+		t.Fatalf("unexpected attempts %v", attempts)
+	}
+	if (*status.TaskStatuses)[0].Status != gojobcoordinatortest.StatusSuccess {
+		t.Fatalf("unexpected task status %v", (*status.TaskStatuses)[0])
+	}
+}
+
+func TestCoordinatorDependencies(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runnerServer := newTestRunnerServer(t, ctx)
+	cod, _ := newTestCoordinatorServer(t, ctx, gojobcoordinatortest.CoordinatorConfig{})
+
+	if err := cod.Connect(gojobcoordinatortest.TaskRunnerConnectionRequest{Address: runnerServer.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := newTestJobTasks(testProcName, testProcName, testFlakyProcName, testProcName)
+	tasks[0].ID = "compile"
+	tasks[1].ID = "test"
+	tasks[1].DependsOn = []string{"compile"}
+	tasks[2].ID = "flaky"
+	tasks[3].ID = "package"
+	tasks[3].DependsOn = []string{"test", "flaky"}
+
+	resp, err := cod.Start(gojobcoordinatortest.JobStartRequest{Tasks: tasks})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// flakyは初回失敗するためそれに依存するpackageはスキップされる
+	status := waitJobComplete(t, cod, resp.ID, 4, time.Second*5)
+	if status.State != gojobcoordinatortest.JobStatePartiallyFailed {
+		t.Fatalf("unexpected job state %v", status.State)
+	}
+	expects := []string{gojobcoordinatortest.TaskStateSucceeded, gojobcoordinatortest.TaskStateSucceeded, gojobcoordinatortest.TaskStateFailed, gojobcoordinatortest.TaskStateSkipped}
+	for i, expect := range expects {
+		if status.Tasks[i].State != expect {
+			t.Fatalf("tasks[%d] %s != %s", i, status.Tasks[i].State, expect)
+		}
+	}
+
+	compileAttempt, testAttempt := status.Tasks[0].Attempts[0], status.Tasks[1].Attempts[0]
+	if testAttempt.StartedAt.Before(*compileAttempt.FinishedAt) {
+		t.Fatal("依存先の完了前にタスクが開始されています")
+	}
+}
+
+func TestCoordinatorRejectCycle(t *testing.T) {
+	cod := gojobcoordinatortest.NewCoordinator(gojobcoordinatortest.CoordinatorConfig{})
+
+	tasks := newTestJobTasks(testProcName, testProcName, testProcName)
+	tasks[0].ID = "a"
+	tasks[0].DependsOn = []string{"c"}
+	tasks[1].ID = "b"
+	tasks[1].DependsOn = []string{"a"}
+	tasks[2].ID = "c"
+	tasks[2].DependsOn = []string{"b"}
+
+	_, err := cod.Start(gojobcoordinatortest.JobStartRequest{Tasks: tasks})
+	var reqErr *gojobcoordinatortest.JobRequestError
+	if !errors.As(err, &reqErr) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(cod.GetJobs().Jobs) != 0 {
+		t.Fatal("不正なジョブが作成されています")
+	}
+}
+
+func TestCoordinatorResultPlaceholder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runnerServer := newTestRunnerServer(t, ctx)
+	cod, _ := newTestCoordinatorServer(t, ctx, gojobcoordinatortest.CoordinatorConfig{})
+
+	if err := cod.Connect(gojobcoordinatortest.TaskRunnerConnectionRequest{Address: runnerServer.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := newTestJobTasks(testProcName, testProcName, testProcName)
+	tasks[0].ID = "build"
+	tasks[0].Params = &map[string]interface{}{"Artifact": "app.zip", "Size": 3.0}
+	tasks[1].DependsOn = []string{"build"}
+	tasks[1].Params = &map[string]interface{}{"Path": "/out/${build.Artifact}", "Size": "${build.Size}", "Shell": "echo ${env.PATH}", "Literal": "$${build.Artifact}"}
+	tasks[2].DependsOn = []string{"build"}
+	tasks[2].Params = &map[string]interface{}{"Path": "${build.Missing}"}
+
+	resp, err := cod.Start(gojobcoordinatortest.JobStartRequest{Tasks: tasks})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status := waitJobComplete(t, cod, resp.ID, 3, time.Second*5)
+	if status.Tasks[1].State != gojobcoordinatortest.TaskStateSucceeded {
+		t.Fatalf("unexpected state %v", status.Tasks[1].State)
+	}
+	found := false
+	for _, taskStatus := range *status.TaskStatuses {
+		if taskStatus.ID != status.Tasks[1].Attempts[0].TaskID {
+			continue
+		}
+		found = true
+		params := *taskStatus.Params
+		// ジョブに存在しないタスクIDのプレースホルダとエスケープしたものは文字列のまま渡される
+		if params["Path"] != "/out/app.zip" || params["Size"] != 3.0 || params["Shell"] != "echo ${env.PATH}" || params["Literal"] != "${build.Artifact}" {
+			t.Fatalf("unexpected params %v", params)
+		}
+	}
+	if !found {
+		t.Fatal("タスクの状態が取得できませんでした")
+	}
+
+	// 存在しない結果値を参照したタスクは失敗する
+	if status.Tasks[2].State != gojobcoordinatortest.TaskStateFailed || len(status.TaskErrors) != 1 || status.TaskErrors[0].Reason != gojobcoordinatortest.TaskErrorUnresolvedParams {
+		t.Fatalf("unexpected task errors %v", status.TaskErrors)
+	}
+}
+
+func TestCoordinatorRejectPlaceholderWithoutDependency(t *testing.T) {
+	cod := gojobcoordinatortest.NewCoordinator(gojobcoordinatortest.CoordinatorConfig{})
+
+	tasks := newTestJobTasks(testProcName, testProcName)
+	tasks[0].ID = "build"
+	tasks[1].Params = &map[string]interface{}{"Path": "${build.Artifact}"}
+
+	_, err := cod.Start(gojobcoordinatortest.JobStartRequest{Tasks: tasks})
+	var reqErr *gojobcoordinatortest.JobRequestError
+	if !errors.As(err, &reqErr) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestCoordinatorCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runnerServer := newTestRunnerServer(t, ctx)
+	cod, _ := newTestCoordinatorServer(t, ctx, gojobcoordinatortest.CoordinatorConfig{RunnerClientFactory: client.NewRunnerClientFactory(client.Options{RetryNum: 1})})
+
+	if err := cod.Connect(gojobcoordinatortest.TaskRunnerConnectionRequest{Address: runnerServer.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := newTestJobTasks(testWaitProcName, testProcName)
+	tasks[0].ID = "wait"
+	tasks[1].DependsOn = []string{"wait"}
+	resp, err := cod.Start(gojobcoordinatortest.JobStartRequest{Tasks: tasks})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitJobState(t, cod, resp.ID, gojobcoordinatortest.JobStateRunning, time.Second*5)
+	cancelResp, err := cod.Cancel(resp.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 実行中のタスクと依存先を待っているタスクがキャンセルされる
+	if len(cancelResp.Cancelled) != 2 || cancelResp.Cancelled[0].Index != 1 || cancelResp.Cancelled[1].ID != "wait" || cancelResp.Cancelled[1].TaskID == "" ||
+		len(cancelResp.AlreadyFinished) != 0 || len(cancelResp.Failed) != 0 {
+		t.Fatalf("unexpected cancel response %+v", cancelResp)
+	}
+
+	status := waitJobComplete(t, cod, resp.ID, 2, time.Second*5)
+	if status.State != gojobcoordinatortest.JobStateCancelled {
+		t.Fatalf("unexpected job state %v", status.State)
+	}
+	for _, task := range status.Tasks {
+		if task.State != gojobcoordinatortest.TaskStateCancelled {
+			t.Fatalf("unexpected task state %v", task)
+		}
+	}
+
+	// 状態遷移が記録されている
+	var states []string
+	for _, transition := range status.Transitions {
+		states = append(states, transition.State)
+	}
+	expect := []string{gojobcoordinatortest.JobStatePending, gojobcoordinatortest.JobStateWaitingForRunner, gojobcoordinatortest.JobStateRunning, gojobcoordinatortest.JobStateCancelled}
+	if !reflect.DeepEqual(states, expect) {
+		t.Fatalf("%v != %v", states, expect)
+	}
+
+	jobs := cod.GetJobs()
+	if len(jobs.Summaries) != 1 || jobs.Summaries[0].State != gojobcoordinatortest.JobStateCancelled {
+		t.Fatalf("unexpected job summaries %v", jobs.Summaries)
+	}
+
+	// 終了したジョブのタスクはすべて終了済みとなる
+	cancelResp, err = cod.Cancel(resp.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cancelResp.AlreadyFinished) != 2 || len(cancelResp.Cancelled) != 0 || len(cancelResp.Failed) != 0 {
+		t.Fatalf("unexpected cancel response %+v", cancelResp)
+	}
+}
+
+func TestCoordinatorCancelBeforeDispatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runnerServer := newTestRunnerServer(t, ctx)
+	cod, _ := newTestCoordinatorServer(t, ctx, gojobcoordinatortest.CoordinatorConfig{})
+
+	runnerReq := gojobcoordinatortest.TaskRunnerConnectionRequest{Address: runnerServer.URL}
+	if err := cod.Connect(runnerReq); err != nil {
+		t.Fatal(err)
+	}
+	if err := cod.Cordon(runnerReq); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := cod.Start(gojobcoordinatortest.JobStartRequest{Tasks: newTestJobTasks(testProcName)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitJobState(t, cod, resp.ID, gojobcoordinatortest.JobStateWaitingForRunner, time.Second*5)
+
+	cancelResp, err := cod.Cancel(resp.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cancelResp.Cancelled) != 1 || cancelResp.Cancelled[0].TaskID != "" {
+		t.Fatalf("unexpected cancel response %+v", cancelResp)
+	}
+
+	// 割り当て可能になっても割り当て待ちだったタスクは開始されない
+	if err := cod.Uncordon(runnerReq); err != nil {
+		t.Fatal(err)
+	}
+	status := waitJobComplete(t, cod, resp.ID, 1, time.Second*5)
+	if status.State != gojobcoordinatortest.JobStateCancelled || len(status.Tasks[0].Attempts) != 0 {
+		t.Fatalf("unexpected job status %v", status)
+	}
+	if taskIDs := getRunnerTaskIDs(t, runnerServer.URL); len(taskIDs) != 0 {
+		t.Fatalf("unexpected runner tasks %v", taskIDs)
+	}
+}
+
+func TestCoordinatorRunnerCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runnerServer := newTestRunnerServer(t, ctx)
+	cod, _ := newTestCoordinatorServer(t, ctx, gojobcoordinatortest.CoordinatorConfig{})
+
+	if err := cod.Connect(gojobcoordinatortest.TaskRunnerConnectionRequest{Address: runnerServer.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := newTestJobTasks(testWaitProcName)
+	tasks[0].RetryPolicy = &gojobcoordinatortest.RetryPolicy{MaxAttempts: 3}
+	resp, err := cod.Start(gojobcoordinatortest.JobStartRequest{Tasks: tasks})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitJobState(t, cod, resp.ID, gojobcoordinatortest.JobStateRunning, time.Second*5)
+	status, err := cod.GetStatus(resp.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// TaskRunnerへ直接キャンセルを指示したタスクは再試行されずキャンセルとなる
+	res, err := http.Post(fmt.Sprint(runnerServer.URL, "/cancel/", status.Tasks[0].Attempts[0].TaskID), "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	status = waitJobComplete(t, cod, resp.ID, 1, time.Second*5)
+	if status.State != gojobcoordinatortest.JobStateCancelled || status.Tasks[0].State != gojobcoordinatortest.TaskStateCancelled {
+		t.Fatalf("unexpected job status %v", status)
+	}
+	if len(status.Tasks[0].Attempts) != 1 || status.Tasks[0].Attempts[0].Status != gojobcoordinatortest.StatusCancelled {
+		t.Fatalf("unexpected attempts %v", status.Tasks[0].Attempts)
+	}
+}
+
+func TestCoordinatorTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runnerServer := newTestRunnerServer(t, ctx)
+	cod, _ := newTestCoordinatorServer(t, ctx, gojobcoordinatortest.CoordinatorConfig{})
+
+	if err := cod.Connect(gojobcoordinatortest.TaskRunnerConnectionRequest{Address: runnerServer.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	// タスクの制限時間を過ぎたタスクは制限時間切れとなり、他に失敗したタスクがなければジョブも制限時間切れとなる
+	tasks := newTestJobTasks(testWaitProcName)
+	tasks[0].TimeoutSec = 0.2
+	resp, err := cod.Start(gojobcoordinatortest.JobStartRequest{Tasks: tasks})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := waitJobComplete(t, cod, resp.ID, 1, time.Second*5)
+	if status.State != gojobcoordinatortest.JobStateTimedOut || status.Tasks[0].State != gojobcoordinatortest.TaskStateTimedOut {
+		t.Fatalf("unexpected job status %v", status)
+	}
+
+	// ジョブの制限時間を過ぎた場合は実行中のタスクも割り当て待ちのタスクも制限時間切れとなる
+	tasks = newTestJobTasks(testWaitProcName, testProcName)
+	tasks[0].ID = "wait"
+	tasks[1].DependsOn = []string{"wait"}
+	resp, err = cod.Start(gojobcoordinatortest.JobStartRequest{Tasks: tasks, TimeoutSec: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status = waitJobComplete(t, cod, resp.ID, 2, time.Second*5)
+	if status.State != gojobcoordinatortest.JobStateTimedOut {
+		t.Fatalf("unexpected job state %v", status.State)
+	}
+	for _, task := range status.Tasks {
+		if task.State != gojobcoordinatortest.TaskStateTimedOut {
+			t.Fatalf("unexpected task state %v", task)
+		}
+	}
+}
+
+// getRunnerTaskIDs TaskRunnerが保持しているタスクID一覧を取得する
+func getRunnerTaskIDs(t *testing.T, runnerAddr string) []string {
+	res, err := http.Get(runnerAddr + "/tasks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tasks gojobcoordinatortest.TaskListResponse
+	if err := gojobcoordinatortest.ReadJSONFromResponse(res, &tasks); err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	return tasks.Tasks
+}
+
+func TestCoordinatorDeleteJob(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runnerServer := newTestRunnerServer(t, ctx)
+	cod, _ := newTestCoordinatorServer(t, ctx, gojobcoordinatortest.CoordinatorConfig{})
+
+	if err := cod.Connect(gojobcoordinatortest.TaskRunnerConnectionRequest{Address: runnerServer.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := cod.Start(gojobcoordinatortest.JobStartRequest{Tasks: newTestJobTasks(testWaitProcName)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitJobState(t, cod, resp.ID, gojobcoordinatortest.JobStateRunning, time.Second*5)
+
+	// 終了していないジョブは削除できない
+	if err := cod.DeleteJob(resp.ID); !errors.Is(err, gojobcoordinatortest.ErrJobNotFinished) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if _, err := cod.Cancel(resp.ID); err != nil {
+		t.Fatal(err)
+	}
+	waitJobComplete(t, cod, resp.ID, 1, time.Second*5)
+
+	if err := cod.DeleteJob(resp.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cod.GetStatus(resp.ID); !errors.Is(err, gojobcoordinatortest.ErrJobNotFound) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// 結果を取得したタスクはTaskRunnerからも削除される
+	if taskIDs := getRunnerTaskIDs(t, runnerServer.URL); len(taskIDs) != 0 {
+		t.Fatalf("unexpected runner tasks %v", taskIDs)
+	}
+}
+
+func TestCoordinatorMaxFinishedJobs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runnerServer := newTestRunnerServer(t, ctx)
+	cod, _ := newTestCoordinatorServer(t, ctx, gojobcoordinatortest.CoordinatorConfig{MaxFinishedJobs: 1})
+
+	if err := cod.Connect(gojobcoordinatortest.TaskRunnerConnectionRequest{Address: runnerServer.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	var jobIDs []string
+	for i := 0; i < 2; i++ {
+		resp, err := cod.Start(gojobcoordinatortest.JobStartRequest{Tasks: newTestJobTasks(testProcName)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitJobComplete(t, cod, resp.ID, 1, time.Second*5)
+		jobIDs = append(jobIDs, resp.ID)
+	}
+
+	// 終了時刻が古いジョブから削除される
+	deadline := time.Now().Add(time.Second * 5)
+	for time.Now().Before(deadline) {
+		jobs := cod.GetJobs().Jobs
+		if len(jobs) == 1 {
+			if jobs[0] != jobIDs[1] {
+				t.Fatalf("unexpected jobs %v", jobs)
+			}
+			return
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+	t.Fatalf("unexpected jobs %v", cod.GetJobs().Jobs)
+}
+
+// waitJobStored ジョブの全タスクがTaskRunnerに割り当てられた状態でJobStoreに保存されるまで待つ
+func waitJobStored(t *testing.T, store gojobcoordinatortest.JobStore, jobID string, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		records, err := store.LoadJobs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, record := range records {
+			if record.ID != jobID {
+				continue
+			}
+			assigned := true
+			for _, task := range record.Tasks {
+				assigned = assigned && task.ID != ""
+			}
+			if assigned {
+				return
+			}
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+	t.Fatalf("ジョブ %v が %v 以内に保存されませんでした", jobID, timeout)
+}
+
+func TestCoordinatorResume(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runnerServer := newTestRunnerServer(t, ctx)
+	runnerReq := gojobcoordinatortest.TaskRunnerConnectionRequest{Address: runnerServer.URL}
+	dir := t.TempDir()
+
+	store, err := gojobcoordinatortest.NewFileJobStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codCtx, codCancel := context.WithCancel(ctx)
+	cod, codServer := newTestCoordinatorServer(t, codCtx, gojobcoordinatortest.CoordinatorConfig{Store: store})
+	if err := cod.Connect(runnerReq); err != nil {
+		t.Fatal(err)
+	}
+
+	waitResp, err := cod.Start(gojobcoordinatortest.JobStartRequest{Tasks: newTestJobTasks(testWaitProcName)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks := newTestJobTasks(testWaitProcName)
+	tasks[0].Params = &map[string]interface{}{"WaitSec": 3}
+	shortResp, err := cod.Start(gojobcoordinatortest.JobStartRequest{Tasks: tasks})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitJobStored(t, store, waitResp.ID, time.Second*5)
+	waitJobStored(t, store, shortResp.ID, time.Second*5)
+	waitStatus, err := cod.GetStatus(waitResp.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Coordinatorを停止し、同じアドレスと保存先で起動し直す
+	addr := codServer.Listener.Addr().String()
+	codServer.Close()
+	codCancel()
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	restartedAt := time.Now()
+	store, err = gojobcoordinatortest.NewFileJobStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cod, _ = newTestCoordinatorServerWithListener(t, ctx, gojobcoordinatortest.CoordinatorConfig{Store: store}, listener)
+	if err := cod.LoadJobs(); err != nil {
+		t.Fatal(err)
+	}
+
+	// TaskRunnerが再接続する前でも、再開した監視で状態を取得できれば通信できなくなったとは扱われない
+	taskID := waitStatus.Tasks[0].Attempts[0].TaskID
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		status, err := cod.GetStatus(waitResp.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.State != gojobcoordinatortest.JobStateRunning || len(status.Tasks[0].Attempts) != 1 || status.Tasks[0].Attempts[0].TaskID != taskID {
+			t.Fatalf("unexpected status %+v", status)
+		}
+		if status.Tasks[0].StatusUpdatedAt != nil && status.Tasks[0].StatusUpdatedAt.After(restartedAt) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("監視が再開されませんでした %+v", status)
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+	if err := cod.Connect(runnerReq); err != nil {
+		t.Fatal(err)
+	}
+	if status, err := cod.GetStatus(waitResp.ID); err != nil || status.State != gojobcoordinatortest.JobStateRunning || len(status.Tasks[0].Attempts) != 1 {
+		t.Fatalf("unexpected status %+v %v", status, err)
+	}
+
+	// 再開したジョブをキャンセルできる
+	cancelResp, err := cod.Cancel(waitResp.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cancelResp.Cancelled) != 1 || cancelResp.Cancelled[0].TaskID != taskID {
+		t.Fatalf("unexpected cancel response %+v", cancelResp)
+	}
+	if status := waitJobComplete(t, cod, waitResp.ID, 1, time.Second*5); status.State != gojobcoordinatortest.JobStateCancelled {
+		t.Fatalf("unexpected job state %v", status.State)
+	}
+
+	// 再開したジョブは完了まで監視される
+	if status := waitJobComplete(t, cod, shortResp.ID, 1, time.Second*10); status.State != gojobcoordinatortest.JobStateSucceeded {
+		t.Fatalf("unexpected job state %v", status.State)
+	}
+}
+
+// waitRunnerConnected TaskRunnerの接続状態が指定した状態になるまで待つ
+func waitRunnerConnected(t *testing.T, cod *gojobcoordinatortest.Coordinator, addr string, connected bool, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		found := false
+		for _, runner := range cod.GetRunners().Runners {
+			if runner == addr {
+				found = true
+			}
+		}
+		if found == connected {
+			return
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+	t.Fatalf("TaskRunner %v の接続状態が %v になりませんでした", addr, connected)
+}
+
+// waitRunnerState 接続しているTaskRunnerが指定した状態になるまで待つ
+func waitRunnerState(t *testing.T, cod *gojobcoordinatortest.Coordinator, addr, state string, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		for _, status := range cod.GetRunners().Statuses {
+			if status.Address == addr && status.State == state {
+				return
+			}
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+	t.Fatalf("TaskRunner %v が %v 以内に %v になりませんでした", addr, timeout, state)
+}
+
+func TestCoordinatorRunnerRegistration(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runner := gojobcoordinatortest.NewTaskRunner(gojobcoordinatortest.TaskRunnerConfig{TaskNumMax: 2})
+	runner.AddFactory(testProcName, newTestEchoTask)
+	runnerServer := gojobcoordinatortest.NewTaskRunnerServer(runner)
+	go runnerServer.Run(ctx)
+	runnerHTTPServer := httptest.NewServer(runnerServer.NewHTTPHandler())
+	defer runnerHTTPServer.Close()
+
+	cod, codHTTPServer := newTestCoordinatorServer(t, ctx, gojobcoordinatortest.CoordinatorConfig{})
+
+	// TaskRunnerから届いた生存通知と登録の回数を数える
+	var heartbeatNum, registerNum int32
+	countingServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/heartbeat":
+			atomic.AddInt32(&heartbeatNum, 1)
+		case "/register":
+			atomic.AddInt32(&registerNum, 1)
+		}
+		codHTTPServer.Config.Handler.ServeHTTP(rw, r)
+	}))
+	defer countingServer.Close()
+
+	registrationCtx, stopRegistration := context.WithCancel(ctx)
+	registrationDone := make(chan struct{})
+	go func() {
+		defer close(registrationDone)
+		runner.RunRegistration(registrationCtx, gojobcoordinatortest.TaskRunnerRegistrationConfig{
+			CoordinatorURL: countingServer.URL, Address: runnerHTTPServer.URL, HeartbeatInterval: time.Millisecond * 100,
+		})
+	}()
+	waitRunnerConnected(t, cod, runnerHTTPServer.URL, true, time.Second*5)
+
+	// 登録済みのTaskRunnerでジョブを実行できる
+	resp, err := cod.Start(gojobcoordinatortest.JobStartRequest{Tasks: newTestJobTasks(testProcName)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := waitJobComplete(t, cod, resp.ID, 1, time.Second*5); status.State != gojobcoordinatortest.JobStateSucceeded {
+		t.Fatalf("unexpected job state %v", status.State)
+	}
+
+	// 登録が失われた場合は生存通知の応答を受けて再登録される
+	if err := cod.Disconnect(gojobcoordinatortest.TaskRunnerConnectionRequest{Address: runnerHTTPServer.URL}); err != nil {
+		t.Fatal(err)
+	}
+	waitRunnerConnected(t, cod, runnerHTTPServer.URL, true, time.Second*5)
+
+	// 退避が完了した場合は生存通知を送り続けても再登録されない
+	runnerReq := gojobcoordinatortest.TaskRunnerConnectionRequest{Address: runnerHTTPServer.URL}
+	if err := cod.Drain(runnerReq); err != nil {
+		t.Fatal(err)
+	}
+	waitRunnerConnected(t, cod, runnerHTTPServer.URL, false, time.Second*5)
+	heartbeat, err := cod.Heartbeat(gojobcoordinatortest.TaskRunnerHeartbeatRequest{Address: runnerHTTPServer.URL})
+	if err != nil || heartbeat.State != gojobcoordinatortest.RunnerStateDrained {
+		t.Fatalf("unexpected heartbeat response %v %v", heartbeat, err)
+	}
+	if err := cod.Register(gojobcoordinatortest.TaskRunnerRegisterRequest{Address: runnerHTTPServer.URL}); !errors.Is(err, gojobcoordinatortest.ErrRunnerDrained) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	registered := atomic.LoadInt32(&registerNum)
+	heartbeats := atomic.LoadInt32(&heartbeatNum)
+	deadline := time.Now().Add(time.Second * 5)
+	for atomic.LoadInt32(&heartbeatNum) < heartbeats+3 {
+		if time.Now().After(deadline) {
+			t.Fatal("退避後に生存通知が届きませんでした")
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+	if num := atomic.LoadInt32(&registerNum); num != registered {
+		t.Fatalf("drained runner registered again %d != %d", num, registered)
+	}
+	if runners := cod.GetRunners(); len(runners.Runners) != 0 {
+		t.Fatalf("unexpected runners %v", runners.Runners)
+	}
+
+	// Uncordonすると再登録される
+	if err := cod.Uncordon(runnerReq); err != nil {
+		t.Fatal(err)
+	}
+	waitRunnerConnected(t, cod, runnerHTTPServer.URL, true, time.Second*5)
+
+	// 停止時は登録を解除する
+	stopRegistration()
+	<-registrationDone
+	waitRunnerConnected(t, cod, runnerHTTPServer.URL, false, time.Second*5)
+
+	// 未登録のTaskRunnerからの生存通知は拒否される
+	_, err = cod.Heartbeat(gojobcoordinatortest.TaskRunnerHeartbeatRequest{Address: runnerHTTPServer.URL})
+	if !errors.Is(err, gojobcoordinatortest.ErrRunnerNotRegistered) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestCoordinatorRunnerSelfDrain(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runner := gojobcoordinatortest.NewTaskRunner(gojobcoordinatortest.TaskRunnerConfig{TaskNumMax: 2})
+	runner.AddFactory(testWaitProcName, newTestWaitTask)
+	runnerServer := gojobcoordinatortest.NewTaskRunnerServer(runner)
+	go runnerServer.Run(ctx)
+	runnerHTTPServer := httptest.NewServer(runnerServer.NewHTTPHandler())
+	defer runnerHTTPServer.Close()
+
+	cod, codHTTPServer := newTestCoordinatorServer(t, ctx, gojobcoordinatortest.CoordinatorConfig{})
+
+	registrationCtx, stopRegistration := context.WithCancel(ctx)
+	registrationDone := make(chan struct{})
+	go func() {
+		defer close(registrationDone)
+		runner.RunRegistration(registrationCtx, gojobcoordinatortest.TaskRunnerRegistrationConfig{
+			CoordinatorURL: codHTTPServer.URL, Address: runnerHTTPServer.URL, HeartbeatInterval: time.Millisecond * 100, DrainTimeout: time.Second * 10,
+		})
+	}()
+	waitRunnerConnected(t, cod, runnerHTTPServer.URL, true, time.Second*5)
+
+	resp, err := cod.Start(gojobcoordinatortest.JobStartRequest{Tasks: newTestJobTasks(testWaitProcName)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitJobState(t, cod, resp.ID, gojobcoordinatortest.JobStateRunning, time.Second*5)
+
+	// 停止時は退避を依頼する
+	stopRegistration()
+	waitRunnerState(t, cod, runnerHTTPServer.URL, gojobcoordinatortest.RunnerStateDraining, time.Second*5)
+
+	// 退避中に登録が失われても完了とはみなさず、再登録して退避を依頼し直す
+	runnerReq := gojobcoordinatortest.TaskRunnerConnectionRequest{Address: runnerHTTPServer.URL}
+	if err := cod.Disconnect(runnerReq); err != nil {
+		t.Fatal(err)
+	}
+	waitRunnerState(t, cod, runnerHTTPServer.URL, gojobcoordinatortest.RunnerStateDraining, time.Second*5)
+	select {
+	case <-registrationDone:
+		t.Fatal("退避が完了する前に登録が終了しました")
+	default:
+	}
+
+	// 実行中のタスクが終了すると退避が完了し、退避済みの記録を削除してから戻る
+	if _, err := cod.Cancel(resp.ID); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-registrationDone:
+	case <-time.After(time.Second * 5):
+		t.Fatal("退避が完了しませんでした")
+	}
+	if _, err := cod.Heartbeat(gojobcoordinatortest.TaskRunnerHeartbeatRequest{Address: runnerHTTPServer.URL}); !errors.Is(err, gojobcoordinatortest.ErrRunnerNotRegistered) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestCoordinatorLabelSelector(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	linuxServer := newTestRunnerServerWithConfig(t, ctx, gojobcoordinatortest.TaskRunnerConfig{TaskNumMax: 2, Labels: map[string]string{"os": "linux"}})
+	gpuServer := newTestRunnerServerWithConfig(t, ctx, gojobcoordinatortest.TaskRunnerConfig{TaskNumMax: 2, Labels: map[string]string{"os": "linux", "gpu": "true"}})
+	cod, _ := newTestCoordinatorServer(t, ctx, gojobcoordinatortest.CoordinatorConfig{})
+
+	for _, server := range []*httptest.Server{linuxServer, gpuServer} {
+		if err := cod.Connect(gojobcoordinatortest.TaskRunnerConnectionRequest{Address: server.URL}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tasks := newTestJobTasks(testProcName, testProcName, testProcName)
+	tasks[0].Selector = gojobcoordinatortest.LabelSelector{{Key: "gpu", Operator: gojobcoordinatortest.LabelOpExists}}
+	resp, err := cod.Start(gojobcoordinatortest.JobStartRequest{
+		Tasks:    tasks,
+		Selector: gojobcoordinatortest.LabelSelector{{Key: "os", Operator: gojobcoordinatortest.LabelOpIn, Values: []string{"linux", "darwin"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := waitJobComplete(t, cod, resp.ID, 3, time.Second*5)
+	if status.State != gojobcoordinatortest.JobStateSucceeded {
+		t.Fatalf("unexpected job state %v", status.State)
+	}
+	if runnerAddr := status.Tasks[0].Attempts[0].RunnerAddr; runnerAddr != gpuServer.URL {
+		t.Fatalf("unexpected runner %v", runnerAddr)
+	}
+
+	// 不正なselectorは受け付けない
+	tasks[0].Selector = gojobcoordinatortest.LabelSelector{{Key: "gpu", Operator: gojobcoordinatortest.LabelOpEquals}}
+	_, err = cod.Start(gojobcoordinatortest.JobStartRequest{Tasks: tasks})
+	var reqErr *gojobcoordinatortest.JobRequestError
+	if !errors.As(err, &reqErr) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestCoordinatorCordonAndDrain(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runnerServer := newTestRunnerServer(t, ctx)
+	cod, _ := newTestCoordinatorServer(t, ctx, gojobcoordinatortest.CoordinatorConfig{})
+
+	runnerReq := gojobcoordinatortest.TaskRunnerConnectionRequest{Address: runnerServer.URL}
+	if err := cod.Connect(runnerReq); err != nil {
+		t.Fatal(err)
+	}
+
+	// 割り当て停止中はタスクを開始せず、再開すると開始する
+	if err := cod.Cordon(runnerReq); err != nil {
+		t.Fatal(err)
+	}
+	if state := cod.GetRunners().Statuses[0].State; state != gojobcoordinatortest.RunnerStateCordoned {
+		t.Fatalf("unexpected runner state %v", state)
+	}
+	resp, err := cod.Start(gojobcoordinatortest.JobStartRequest{Tasks: newTestJobTasks(testWaitProcName)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitJobState(t, cod, resp.ID, gojobcoordinatortest.JobStateWaitingForRunner, time.Second*5)
+	if err := cod.Uncordon(runnerReq); err != nil {
+		t.Fatal(err)
+	}
+	waitJobState(t, cod, resp.ID, gojobcoordinatortest.JobStateRunning, time.Second*5)
+
+	// 実行中のタスクとTaskRunnerから取得した情報が一覧に含まれる
+	runnerStatus := cod.GetRunners().Statuses[0]
+	if len(runnerStatus.Tasks) != 1 || runnerStatus.Tasks[0].JobID != resp.ID || runnerStatus.TaskNumMax != 2 || runnerStatus.ActiveTaskNum != 1 {
+		t.Fatalf("unexpected runner status %v", runnerStatus)
+	}
+	expectProcs := []string{testProcName, testFlakyProcName, testWaitProcName}
+	sort.Strings(expectProcs)
+	if !reflect.DeepEqual(runnerStatus.Procs, expectProcs) {
+		t.Fatalf("%v != %v", runnerStatus.Procs, expectProcs)
+	}
+
+	// 退避中は実行中のタスクが終了するまで接続を維持する
+	if err := cod.Drain(runnerReq); err != nil {
+		t.Fatal(err)
+	}
+	waitRunnerState(t, cod, runnerServer.URL, gojobcoordinatortest.RunnerStateDraining, time.Second*5)
+	if runners := cod.GetRunners(); len(runners.Statuses) != 1 || len(runners.Statuses[0].Tasks) != 1 {
+		t.Fatalf("unexpected runners %v", runners)
+	}
+
+	// 実行中のタスクが終了すると接続が解除される
+	if _, err := cod.Cancel(resp.ID); err != nil {
+		t.Fatal(err)
+	}
+	waitJobComplete(t, cod, resp.ID, 1, time.Second*5)
+	waitRunnerConnected(t, cod, runnerServer.URL, false, time.Second*5)
+}
@@ -0,0 +1,256 @@
+package gojobcoordinatortest
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	fileJobStoreSnapshotName = "jobs.snapshot"
+	fileJobStoreLogName      = "jobs.log"
+
+	// DefaultSnapshotInterval FileJobStoreがスナップショットを作成するまでのログ追記回数の既定値
+	DefaultSnapshotInterval = 100
+)
+
+const (
+	jobStoreOpSave   string = "save"
+	jobStoreOpDelete string = "delete"
+)
+
+// jobStoreLogEntry FileJobStoreのログファイルに1行ずつ追記する更新内容
+type jobStoreLogEntry struct {
+	Op  string     `json:"op"`
+	ID  string     `json:"id"`
+	Job *JobRecord `json:"job,omitempty"`
+}
+
+// FileJobStore ファイルにジョブ情報を保存するJobStoreの実装
+// 更新内容は追記専用のログファイルに書き込み、SnapshotInterval回追記するごとに
+// 全ジョブ情報のスナップショットを作成してログファイルを空にする
+type FileJobStore struct {
+	dir              string
+	snapshotInterval int
+	lock             sync.Mutex
+	jobs             map[string]JobRecord
+	logFile          *os.File
+	logCount         int
+}
+
+// NewFileJobStore FileJobStoreの作成
+// dirに保存先ディレクトリを指定する。存在しない場合は作成する。
+// snapshotIntervalに0以下を指定した場合はDefaultSnapshotIntervalを使用する。
+func NewFileJobStore(dir string, snapshotInterval int) (*FileJobStore, error) {
+	if snapshotInterval <= 0 {
+		snapshotInterval = DefaultSnapshotInterval
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("ジョブ保存先ディレクトリの作成に失敗しました:%s", err.Error())
+	}
+
+	store := &FileJobStore{dir: dir, snapshotInterval: snapshotInterval, jobs: map[string]JobRecord{}}
+	if err := store.readSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := store.replayLog(); err != nil {
+		return nil, err
+	}
+
+	logFile, err := os.OpenFile(store.logPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("ジョブログファイルを開けませんでした:%s", err.Error())
+	}
+	store.logFile = logFile
+
+	// 読み込んだ内容でスナップショットを作り直し、途中で書き込みが途切れたログを取り除く
+	if err := store.compact(); err != nil {
+		logFile.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Close ログファイルを閉じる
+func (store *FileJobStore) Close() error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	return store.logFile.Close()
+}
+
+// SaveJob JobStoreインターフェイスの実装
+func (store *FileJobStore) SaveJob(record JobRecord) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if err := store.appendLog(jobStoreLogEntry{Op: jobStoreOpSave, ID: record.ID, Job: &record}); err != nil {
+		return err
+	}
+	store.jobs[record.ID] = record
+	return store.compactIfNeeded()
+}
+
+// DeleteJob JobStoreインターフェイスの実装
+func (store *FileJobStore) DeleteJob(jobID string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if err := store.appendLog(jobStoreLogEntry{Op: jobStoreOpDelete, ID: jobID}); err != nil {
+		return err
+	}
+	delete(store.jobs, jobID)
+	return store.compactIfNeeded()
+}
+
+// LoadJobs JobStoreインターフェイスの実装
+func (store *FileJobStore) LoadJobs() ([]JobRecord, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	records := make([]JobRecord, 0, len(store.jobs))
+	for _, record := range store.jobs {
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (store *FileJobStore) snapshotPath() string {
+	return filepath.Join(store.dir, fileJobStoreSnapshotName)
+}
+
+func (store *FileJobStore) logPath() string {
+	return filepath.Join(store.dir, fileJobStoreLogName)
+}
+
+func (store *FileJobStore) readSnapshot() error {
+	data, err := os.ReadFile(store.snapshotPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("スナップショットの読み込みに失敗しました:%s", err.Error())
+	}
+
+	var records []JobRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return fmt.Errorf("スナップショットの解析に失敗しました:%s", err.Error())
+	}
+	for _, record := range records {
+		store.jobs[record.ID] = record
+	}
+	return nil
+}
+
+func (store *FileJobStore) replayLog() error {
+	file, err := os.Open(store.logPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("ジョブログファイルの読み込みに失敗しました:%s", err.Error())
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// 改行で終わっていない行は書き込み途中で停止したものなので無視する
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("ジョブログファイルの読み込みに失敗しました:%s", err.Error())
+		}
+
+		var entry jobStoreLogEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return fmt.Errorf("ジョブログファイルの解析に失敗しました:%s", err.Error())
+		}
+
+		switch entry.Op {
+		case jobStoreOpSave:
+			if entry.Job != nil {
+				store.jobs[entry.ID] = *entry.Job
+			}
+		case jobStoreOpDelete:
+			delete(store.jobs, entry.ID)
+		default:
+			return fmt.Errorf("ジョブログファイルに不明な操作が含まれています:%s", entry.Op)
+		}
+	}
+}
+
+func (store *FileJobStore) appendLog(entry jobStoreLogEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if _, err := store.logFile.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("ジョブログファイルへの書き込みに失敗しました:%s", err.Error())
+	}
+	if err := store.logFile.Sync(); err != nil {
+		return fmt.Errorf("ジョブログファイルへの書き込みに失敗しました:%s", err.Error())
+	}
+
+	store.logCount++
+	return nil
+}
+
+func (store *FileJobStore) compactIfNeeded() error {
+	if store.logCount < store.snapshotInterval {
+		return nil
+	}
+	return store.compact()
+}
+
+// compact 現在のジョブ情報をスナップショットに書き出しログファイルを空にする
+// スナップショットは一時ファイルに書き込んでから置き換えるため、途中で停止しても以前のスナップショットは壊れない
+func (store *FileJobStore) compact() error {
+	records := make([]JobRecord, 0, len(store.jobs))
+	for _, record := range store.jobs {
+		records = append(records, record)
+	}
+
+	data, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := store.snapshotPath() + ".tmp"
+	if err := writeFileSync(tmpPath, data); err != nil {
+		return fmt.Errorf("スナップショットの書き込みに失敗しました:%s", err.Error())
+	}
+	if err := os.Rename(tmpPath, store.snapshotPath()); err != nil {
+		return fmt.Errorf("スナップショットの書き込みに失敗しました:%s", err.Error())
+	}
+
+	if err := store.logFile.Truncate(0); err != nil {
+		return fmt.Errorf("ジョブログファイルの切り詰めに失敗しました:%s", err.Error())
+	}
+	store.logCount = 0
+	return nil
+}
+
+func writeFileSync(path string, data []byte) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,111 @@
+package gojobcoordinatortest_test
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/y-akahori-ramen/gojobcoordinatortest"
+)
+
+func newTestJobRecord(id string) gojobcoordinatortest.JobRecord {
+	params := map[string]interface{}{"Value": id}
+	return gojobcoordinatortest.JobRecord{
+		ID: id,
+		Request: gojobcoordinatortest.JobStartRequest{
+			Tasks: []gojobcoordinatortest.JobTaskRequest{{TaskStartRequest: gojobcoordinatortest.TaskStartRequest{ProcName: "Echo", Params: &params}}},
+		},
+		Tasks: []gojobcoordinatortest.TaskRecord{{ID: "task-" + id, RunnerAddr: "http://localhost:8000"}},
+	}
+}
+
+func loadJobIDs(t *testing.T, store gojobcoordinatortest.JobStore) []string {
+	records, err := store.LoadJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, record := range records {
+		ids = append(ids, record.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestFileJobStoreReopen(t *testing.T) {
+	dir := t.TempDir()
+
+	// スナップショットとログの両方から読み込まれるようにスナップショット間隔を小さくする
+	store, err := gojobcoordinatortest.NewFileJobStore(dir, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "b", "c", "d"} {
+		if err := store.SaveJob(newTestJobRecord(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.DeleteJob("b"); err != nil {
+		t.Fatal(err)
+	}
+	completed := newTestJobRecord("c")
+	completed.Completed = true
+	if err := store.SaveJob(completed); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	store, err = gojobcoordinatortest.NewFileJobStore(dir, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	ids := loadJobIDs(t, store)
+	if len(ids) != 3 || ids[0] != "a" || ids[1] != "c" || ids[2] != "d" {
+		t.Fatalf("unexpected jobs %v", ids)
+	}
+
+	records, _ := store.LoadJobs()
+	for _, record := range records {
+		if record.ID == "c" && !record.Completed {
+			t.Fatal("更新内容が復元されていません")
+		}
+		if record.Tasks[0].ID != "task-"+record.ID {
+			t.Fatalf("タスク情報が復元されていません %v", record.Tasks)
+		}
+	}
+}
+
+func TestFileJobStoreTornLog(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := gojobcoordinatortest.NewFileJobStore(dir, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveJob(newTestJobRecord("a")); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	// 書き込み途中で停止した状態を再現する
+	logFile, err := os.OpenFile(filepath.Join(dir, "jobs.log"), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logFile.WriteString(`{"op":"save","id":"b","jo`)
+	logFile.Close()
+
+	store, err = gojobcoordinatortest.NewFileJobStore(dir, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	ids := loadJobIDs(t, store)
+	if len(ids) != 1 || ids[0] != "a" {
+		t.Fatalf("unexpected jobs %v", ids)
+	}
+}
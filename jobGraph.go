@@ -0,0 +1,170 @@
+package gojobcoordinatortest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// JobRequestError ジョブ開始リクエストの内容が不正な場合のエラー
+// Violationsには見つかった問題がすべて入る
+type JobRequestError struct {
+	Violations []string
+}
+
+func (e *JobRequestError) Error() string {
+	return fmt.Sprint("ジョブ開始リクエストが不正です: ", strings.Join(e.Violations, ", "))
+}
+
+// validateJobRequest ジョブ開始リクエストの内容を検証する
+// 問題がある場合は見つかった問題をすべて含む*JobRequestErrorを返す
+func validateJobRequest(req JobStartRequest) error {
+	var violations []string
+	if _, err := buildTaskGraph(req.Tasks); err != nil {
+		var reqErr *JobRequestError
+		if !errors.As(err, &reqErr) {
+			return err
+		}
+		violations = append(violations, reqErr.Violations...)
+	}
+
+	if err := req.Selector.Validate(); err != nil {
+		violations = append(violations, fmt.Sprintf("selectorが不正です %s", err.Error()))
+	}
+	for i, task := range req.Tasks {
+		if err := task.Selector.Validate(); err != nil {
+			violations = append(violations, fmt.Sprintf("tasks[%d]のselectorが不正です %s", i, err.Error()))
+		}
+	}
+
+	if len(violations) > 0 {
+		return &JobRequestError{Violations: violations}
+	}
+	return nil
+}
+
+// buildTaskGraph ジョブ内タスクの依存関係を解析し、各タスクが依存するタスクの位置一覧を返す
+// IDの重複、存在しないIDへの依存、循環する依存関係、依存関係にないタスクの結果値の参照がある場合は*JobRequestErrorを返す
+func buildTaskGraph(tasks []JobTaskRequest) ([][]int, error) {
+	var violations []string
+
+	indexByID := map[string]int{}
+	for i, task := range tasks {
+		if task.ID == "" {
+			continue
+		}
+		if _, exist := indexByID[task.ID]; exist {
+			violations = append(violations, fmt.Sprintf("タスクID %s が重複しています", task.ID))
+			continue
+		}
+		indexByID[task.ID] = i
+	}
+
+	deps := make([][]int, len(tasks))
+	for i, task := range tasks {
+		for _, depID := range task.DependsOn {
+			depIndex, exist := indexByID[depID]
+			if !exist {
+				violations = append(violations, fmt.Sprintf("tasks[%d]の依存先タスクID %s が存在しません", i, depID))
+				continue
+			}
+			if depIndex == i {
+				violations = append(violations, fmt.Sprintf("tasks[%d]が自身に依存しています", i))
+				continue
+			}
+			deps[i] = append(deps[i], depIndex)
+		}
+	}
+
+	if len(violations) == 0 {
+		if cycle := findTaskCycle(deps); cycle != nil {
+			var ids []string
+			for _, index := range cycle {
+				ids = append(ids, tasks[index].ID)
+			}
+			violations = append(violations, fmt.Sprintf("タスクの依存関係が循環しています %s", strings.Join(ids, " -> ")))
+		}
+	}
+
+	// パラメータで結果値を参照できるのは依存先(間接的な依存先を含む)のタスクのみ
+	// ジョブに存在しないタスクIDのプレースホルダは参照ではなく文字列として扱う
+	if len(violations) == 0 {
+		for i, task := range tasks {
+			ancestors := taskAncestors(deps, i)
+			for _, refID := range placeholderTaskIDs(task.Params) {
+				refIndex, exist := indexByID[refID]
+				if !exist {
+					continue
+				}
+				if !ancestors[refIndex] {
+					violations = append(violations, fmt.Sprintf("tasks[%d]のパラメータが依存先ではないタスクID %s の結果値を参照しています", i, refID))
+				}
+			}
+		}
+	}
+
+	if len(violations) > 0 {
+		return nil, &JobRequestError{Violations: violations}
+	}
+	return deps, nil
+}
+
+// findTaskCycle 依存関係に循環があればそれを構成するタスクの位置を依存順に返す。循環がなければnilを返す
+func findTaskCycle(deps [][]int) []int {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	marks := make([]int, len(deps))
+	var stack []int
+
+	var visit func(index int) []int
+	visit = func(index int) []int {
+		marks[index] = visiting
+		stack = append(stack, index)
+		for _, dep := range deps[index] {
+			switch marks[dep] {
+			case visiting:
+				// スタック上のdepから現在位置までが循環している
+				for i, stacked := range stack {
+					if stacked == dep {
+						return append(append([]int{}, stack[i:]...), dep)
+					}
+				}
+			case unvisited:
+				if cycle := visit(dep); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		marks[index] = visited
+		return nil
+	}
+
+	for i := range deps {
+		if marks[i] == unvisited {
+			if cycle := visit(i); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// taskAncestors 指定したタスクが直接・間接的に依存するタスクの位置を取得する
+func taskAncestors(deps [][]int, index int) map[int]bool {
+	ancestors := map[int]bool{}
+	stack := append([]int{}, deps[index]...)
+	for len(stack) > 0 {
+		dep := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if ancestors[dep] {
+			continue
+		}
+		ancestors[dep] = true
+		stack = append(stack, deps[dep]...)
+	}
+	return ancestors
+}
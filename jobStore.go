@@ -0,0 +1,49 @@
+package gojobcoordinatortest
+
+import "time"
+
+// JobStore ジョブ情報の永続化インターフェース
+// Coordinatorが再起動してもジョブ情報を引き継ぐために使用します。スレッドセーフである必要があります。
+type JobStore interface {
+	// SaveJob ジョブ情報を保存する。同じIDのジョブ情報が保存済みの場合は上書きする
+	SaveJob(record JobRecord) error
+	// DeleteJob 指定したIDのジョブ情報を削除する
+	DeleteJob(jobID string) error
+	// LoadJobs 保存されている全ジョブ情報を取得する
+	LoadJobs() ([]JobRecord, error)
+}
+
+// JobRecord JobStoreに保存するジョブ情報
+// TasksはRequest.Tasksと同じ並びで、各タスクの割り当て先を保持する
+// State,TransitionsにはJobStatusResponseと同じ値が入る
+// TimedOutはジョブの制限時間を過ぎたかを表す
+type JobRecord struct {
+	ID          string               `json:"id"`
+	Request     JobStartRequest      `json:"request"`
+	Tasks       []TaskRecord         `json:"tasks"`
+	Completed   bool                 `json:"completed"`
+	Cancelled   bool                 `json:"cancelled"`
+	TimedOut    bool                 `json:"timedOut,omitempty"`
+	State       string               `json:"state"`
+	Transitions []JobStateTransition `json:"transitions"`
+}
+
+// TaskRecord JobStoreに保存するタスクの割り当て情報
+// まだTaskRunnerに割り当てられていないタスクはIDが空となる
+// Error,Reasonには実行を完了できずに終了したタスクのエラー内容と理由が入る
+// Attemptsにはこれまでの試行履歴が入る
+// StateにはJobTaskStatusのStateと同じ値が入る
+// ResultValuesには成功したタスクの結果値が入る。依存するタスクのパラメータ解決に使用する
+// LastStatus,StatusUpdatedAt,LastErrorにはJobTaskStatusと同じ値が入る
+type TaskRecord struct {
+	State           string                  `json:"state"`
+	ID              string                  `json:"id"`
+	RunnerAddr      string                  `json:"runnerAddr"`
+	Error           string                  `json:"error,omitempty"`
+	Reason          string                  `json:"reason,omitempty"`
+	Attempts        []TaskAttempt           `json:"attempts,omitempty"`
+	ResultValues    *map[string]interface{} `json:"resultValues,omitempty"`
+	LastStatus      *TaskStatusResponse     `json:"lastStatus,omitempty"`
+	StatusUpdatedAt *time.Time              `json:"statusUpdatedAt,omitempty"`
+	LastError       string                  `json:"lastError,omitempty"`
+}
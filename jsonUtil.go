@@ -5,8 +5,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 )
 
+// jsonRequestTimeout TaskRunnerからコーディネーターサーバーやコールバック先へ送るリクエストの最大待ち時間
+const jsonRequestTimeout = time.Second * 30
+
+// jsonHTTPClient 応答しない送信先で処理が止まらないよう、待ち時間を制限したHTTPクライアント
+var jsonHTTPClient = &http.Client{Timeout: jsonRequestTimeout}
+
 // ReadJSONFromRequest HTTPリクエストのBodyをJSONデータと仮定し、そのJSONを読み込みます
 // エラーが発生した場合http.ResponseWriterに書き込まれます
 func ReadJSONFromRequest(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
@@ -44,6 +51,29 @@ func NewJSONRequest(method, url string, sendJSONData interface{}) (*http.Request
 	}
 
 	req, err := http.NewRequest(method, url, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, err
+	}
 	req.Header.Set("Content-Type", "application/json")
-	return req, err
+	return req, nil
+}
+
+// postJSON 指定したデータをJSON形式でPOSTします
+// 200 OK以外の応答はエラーとして扱います
+func postJSON(url string, sendJSONData interface{}) error {
+	req, err := NewJSONRequest(http.MethodPost, url, sendJSONData)
+	if err != nil {
+		return err
+	}
+
+	res, err := jsonHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%v への送信に失敗しました StatusCode:%v", url, res.StatusCode)
+	}
+	return nil
 }
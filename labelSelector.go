@@ -0,0 +1,74 @@
+package gojobcoordinatortest
+
+import "fmt"
+
+// Matches 指定したラベルがすべての条件に一致するかを調べる
+func (selector LabelSelector) Matches(labels map[string]string) bool {
+	for _, requirement := range selector {
+		if !requirement.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate 条件の内容が正しいかを調べる
+func (selector LabelSelector) Validate() error {
+	for _, requirement := range selector {
+		if err := requirement.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Matches 指定したラベルが条件に一致するかを調べる
+func (requirement LabelRequirement) Matches(labels map[string]string) bool {
+	value, exist := labels[requirement.Key]
+	switch requirement.Operator {
+	case LabelOpEquals, LabelOpIn:
+		return exist && containsString(requirement.Values, value)
+	case LabelOpNotEquals, LabelOpNotIn:
+		return !exist || !containsString(requirement.Values, value)
+	case LabelOpExists:
+		return exist
+	case LabelOpNotExists:
+		return !exist
+	default:
+		return false
+	}
+}
+
+// Validate 条件の内容が正しいかを調べる
+func (requirement LabelRequirement) Validate() error {
+	if requirement.Key == "" {
+		return fmt.Errorf("ラベル条件のキーが指定されていません")
+	}
+
+	switch requirement.Operator {
+	case LabelOpEquals, LabelOpNotEquals:
+		if len(requirement.Values) != 1 {
+			return fmt.Errorf("ラベル %s の条件 %s には値を1つ指定してください", requirement.Key, requirement.Operator)
+		}
+	case LabelOpIn, LabelOpNotIn:
+		if len(requirement.Values) == 0 {
+			return fmt.Errorf("ラベル %s の条件 %s には値を1つ以上指定してください", requirement.Key, requirement.Operator)
+		}
+	case LabelOpExists, LabelOpNotExists:
+		if len(requirement.Values) != 0 {
+			return fmt.Errorf("ラベル %s の条件 %s には値を指定できません", requirement.Key, requirement.Operator)
+		}
+	default:
+		return fmt.Errorf("ラベル %s の条件 %s は存在しません", requirement.Key, requirement.Operator)
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package gojobcoordinatortest_test
+
+import (
+	"testing"
+
+	"github.com/y-akahori-ramen/gojobcoordinatortest"
+)
+
+func TestLabelSelectorMatches(t *testing.T) {
+	labels := map[string]string{"os": "linux", "pool": "batch"}
+
+	tests := []struct {
+		selector gojobcoordinatortest.LabelSelector
+		expect   bool
+	}{
+		{gojobcoordinatortest.LabelSelector{}, true},
+		{gojobcoordinatortest.LabelSelector{{Key: "os", Operator: gojobcoordinatortest.LabelOpEquals, Values: []string{"linux"}}}, true},
+		{gojobcoordinatortest.LabelSelector{{Key: "os", Operator: gojobcoordinatortest.LabelOpEquals, Values: []string{"windows"}}}, false},
+		{gojobcoordinatortest.LabelSelector{{Key: "os", Operator: gojobcoordinatortest.LabelOpNotEquals, Values: []string{"windows"}}}, true},
+		{gojobcoordinatortest.LabelSelector{{Key: "gpu", Operator: gojobcoordinatortest.LabelOpNotEquals, Values: []string{"true"}}}, true},
+		{gojobcoordinatortest.LabelSelector{{Key: "pool", Operator: gojobcoordinatortest.LabelOpIn, Values: []string{"batch", "web"}}}, true},
+		{gojobcoordinatortest.LabelSelector{{Key: "pool", Operator: gojobcoordinatortest.LabelOpNotIn, Values: []string{"batch", "web"}}}, false},
+		{gojobcoordinatortest.LabelSelector{{Key: "gpu", Operator: gojobcoordinatortest.LabelOpIn, Values: []string{"true"}}}, false},
+		{gojobcoordinatortest.LabelSelector{{Key: "gpu", Operator: gojobcoordinatortest.LabelOpNotExists}}, true},
+		{gojobcoordinatortest.LabelSelector{
+			{Key: "os", Operator: gojobcoordinatortest.LabelOpExists},
+			{Key: "pool", Operator: gojobcoordinatortest.LabelOpEquals, Values: []string{"web"}},
+		}, false},
+	}
+	for _, test := range tests {
+		if result := test.selector.Matches(labels); result != test.expect {
+			t.Fatalf("%v: %v != %v", test.selector, result, test.expect)
+		}
+	}
+}
+
+func TestLabelSelectorValidate(t *testing.T) {
+	invalids := []gojobcoordinatortest.LabelSelector{
+		{{Key: "", Operator: gojobcoordinatortest.LabelOpExists}},
+		{{Key: "os", Operator: "~"}},
+		{{Key: "os", Operator: gojobcoordinatortest.LabelOpEquals, Values: []string{"a", "b"}}},
+		{{Key: "os", Operator: gojobcoordinatortest.LabelOpIn}},
+		{{Key: "os", Operator: gojobcoordinatortest.LabelOpExists, Values: []string{"a"}}},
+	}
+	for _, selector := range invalids {
+		if err := selector.Validate(); err == nil {
+			t.Fatalf("%v is valid", selector)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package gojobcoordinatortest
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// placeholderPattern 他タスクの結果値を参照するプレースホルダ
+// ${タスクID.結果値名} の形式で指定する。結果値がマップの場合は ${タスクID.結果値名.キー} のように辿ることができる
+// ジョブに存在しないタスクIDを指定したものはプレースホルダとして扱わずそのまま渡す。$${...} と書いた場合は ${...} という文字列になる
+var placeholderPattern = regexp.MustCompile(`\$?\$\{([^.}]+)\.([^}]+)\}`)
+
+// isEscapedPlaceholder matchが $${...} と書かれたエスケープであるかを返す
+func isEscapedPlaceholder(value string, match []int) bool {
+	return value[match[0]+1] == '$'
+}
+
+// placeholderTaskIDs パラメータ内のプレースホルダが参照するタスクIDの一覧を取得する
+// ジョブに存在しないタスクIDも含まれるため、呼び出し側で存在するものだけを参照として扱う
+func placeholderTaskIDs(params *map[string]interface{}) []string {
+	if params == nil {
+		return nil
+	}
+
+	var ids []string
+	walkParamStrings(*params, func(value string) {
+		for _, match := range placeholderPattern.FindAllStringSubmatchIndex(value, -1) {
+			if !isEscapedPlaceholder(value, match) {
+				ids = append(ids, value[match[2]:match[3]])
+			}
+		}
+	})
+	return ids
+}
+
+func walkParamStrings(value interface{}, f func(string)) {
+	switch v := value.(type) {
+	case string:
+		f(v)
+	case map[string]interface{}:
+		for _, elem := range v {
+			walkParamStrings(elem, f)
+		}
+	case []interface{}:
+		for _, elem := range v {
+			walkParamStrings(elem, f)
+		}
+	}
+}
+
+// resolveParams パラメータ内のプレースホルダを参照先タスクの結果値で置き換えたパラメータを返す
+// 文字列全体がプレースホルダの場合は結果値をそのままの型で置き換え、文字列の一部の場合は文字列として埋め込む
+// resultsにはジョブ内のすべてのタスクIDについて結果値を指定する。resultsにないタスクIDのプレースホルダはそのまま残す
+// 参照先の結果値が存在しない場合はエラーを返す
+func resolveParams(params *map[string]interface{}, results map[string]*map[string]interface{}) (*map[string]interface{}, error) {
+	if params == nil {
+		return nil, nil
+	}
+
+	resolved, err := resolveParamValue(*params, results)
+	if err != nil {
+		return nil, err
+	}
+	resolvedMap := resolved.(map[string]interface{})
+	return &resolvedMap, nil
+}
+
+func resolveParamValue(value interface{}, results map[string]*map[string]interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return resolveParamString(v, results)
+	case map[string]interface{}:
+		resolved := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			resolvedElem, err := resolveParamValue(elem, results)
+			if err != nil {
+				return nil, err
+			}
+			resolved[key] = resolvedElem
+		}
+		return resolved, nil
+	case []interface{}:
+		resolved := make([]interface{}, len(v))
+		for i, elem := range v {
+			resolvedElem, err := resolveParamValue(elem, results)
+			if err != nil {
+				return nil, err
+			}
+			resolved[i] = resolvedElem
+		}
+		return resolved, nil
+	default:
+		return value, nil
+	}
+}
+
+func resolveParamString(value string, results map[string]*map[string]interface{}) (interface{}, error) {
+	matches := placeholderPattern.FindAllStringSubmatchIndex(value, -1)
+	if len(matches) == 0 {
+		return value, nil
+	}
+
+	// 文字列全体がプレースホルダであれば結果値の型を保つ
+	if len(matches) == 1 && matches[0][0] == 0 && matches[0][1] == len(value) && !isEscapedPlaceholder(value, matches[0]) {
+		taskID := value[matches[0][2]:matches[0][3]]
+		if _, exist := results[taskID]; exist {
+			return lookupResultValue(taskID, value[matches[0][4]:matches[0][5]], results)
+		}
+	}
+
+	var builder strings.Builder
+	last := 0
+	for _, match := range matches {
+		builder.WriteString(value[last:match[0]])
+		last = match[1]
+
+		placeholder := value[match[0]:match[1]]
+		if isEscapedPlaceholder(value, match) {
+			builder.WriteString(placeholder[1:])
+			continue
+		}
+		taskID := value[match[2]:match[3]]
+		if _, exist := results[taskID]; !exist {
+			builder.WriteString(placeholder)
+			continue
+		}
+		resultValue, err := lookupResultValue(taskID, value[match[4]:match[5]], results)
+		if err != nil {
+			return nil, err
+		}
+		builder.WriteString(fmt.Sprint(resultValue))
+	}
+	builder.WriteString(value[last:])
+	return builder.String(), nil
+}
+
+func lookupResultValue(taskID, path string, results map[string]*map[string]interface{}) (interface{}, error) {
+	resultValues, ok := results[taskID]
+	if !ok || resultValues == nil {
+		return nil, fmt.Errorf("タスクID %s の結果値が存在しません", taskID)
+	}
+
+	var current interface{} = *resultValues
+	for _, key := range strings.Split(path, ".") {
+		valueMap, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("タスクID %s の結果値 %s が存在しません", taskID, path)
+		}
+		current, ok = valueMap[key]
+		if !ok {
+			return nil, fmt.Errorf("タスクID %s の結果値 %s が存在しません", taskID, path)
+		}
+	}
+	return current, nil
+}
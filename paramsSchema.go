@@ -0,0 +1,260 @@
+package gojobcoordinatortest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ParamsSchema タスクのパラメータを検証するためのJSON Schema
+// JSON Schemaのうち type, properties, required, additionalProperties, items, enum, minimum, maximum に対応する
+// TypeにはParamsType〜の値が入る。空の場合は型を検証しない
+type ParamsSchema struct {
+	Type                 string                   `json:"type,omitempty"`
+	Description          string                   `json:"description,omitempty"`
+	Properties           map[string]*ParamsSchema `json:"properties,omitempty"`
+	Required             []string                 `json:"required,omitempty"`
+	AdditionalProperties *bool                    `json:"additionalProperties,omitempty"`
+	Items                *ParamsSchema            `json:"items,omitempty"`
+	Enum                 []interface{}            `json:"enum,omitempty"`
+	Minimum              *float64                 `json:"minimum,omitempty"`
+	Maximum              *float64                 `json:"maximum,omitempty"`
+}
+
+const (
+	// ParamsTypeObject キーと値の組
+	ParamsTypeObject string = "object"
+	// ParamsTypeArray 配列
+	ParamsTypeArray string = "array"
+	// ParamsTypeString 文字列
+	ParamsTypeString string = "string"
+	// ParamsTypeNumber 数値
+	ParamsTypeNumber string = "number"
+	// ParamsTypeInteger 整数
+	ParamsTypeInteger string = "integer"
+	// ParamsTypeBoolean 真偽値
+	ParamsTypeBoolean string = "boolean"
+)
+
+// ValidateParams タスク開始リクエストのパラメータを検証し、見つかった問題をすべて返す
+// パラメータがnilの場合は空のオブジェクトとして検証する
+// 他タスクの結果値を参照するプレースホルダを含む文字列は、解決後の値が分からないため検証しない
+func (schema *ParamsSchema) ValidateParams(params *map[string]interface{}) []string {
+	var value interface{} = map[string]interface{}{}
+	if params != nil {
+		value = *params
+	}
+
+	var violations []string
+	schema.validate(value, "params", &violations)
+	return violations
+}
+
+func (schema *ParamsSchema) validate(value interface{}, path string, violations *[]string) {
+	if schema == nil {
+		return
+	}
+	if str, ok := value.(string); ok && placeholderPattern.MatchString(str) {
+		return
+	}
+
+	addViolation := func(format string, args ...interface{}) {
+		*violations = append(*violations, fmt.Sprint(path, ": ", fmt.Sprintf(format, args...)))
+	}
+
+	if schema.Type != "" && !isParamsType(value, schema.Type) {
+		addViolation("%sで指定してください", schema.Type)
+		return
+	}
+
+	if len(schema.Enum) > 0 && !containsParamsValue(schema.Enum, value) {
+		addViolation("%vのいずれかを指定してください", schema.Enum)
+	}
+
+	if number, ok := paramsNumber(value); ok {
+		if schema.Minimum != nil && number < *schema.Minimum {
+			addViolation("%v以上の値を指定してください", *schema.Minimum)
+		}
+		if schema.Maximum != nil && number > *schema.Maximum {
+			addViolation("%v以下の値を指定してください", *schema.Maximum)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, key := range schema.Required {
+			if _, ok := v[key]; !ok {
+				addViolation("%sを指定してください", key)
+			}
+		}
+
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			propertySchema, ok := schema.Properties[key]
+			if !ok {
+				if schema.AdditionalProperties != nil && !*schema.AdditionalProperties {
+					addViolation("%sは定義されていない値です", key)
+				}
+				continue
+			}
+			propertySchema.validate(v[key], fmt.Sprint(path, ".", key), violations)
+		}
+	case []interface{}:
+		for i, elem := range v {
+			schema.Items.validate(elem, fmt.Sprintf("%s[%d]", path, i), violations)
+		}
+	}
+}
+
+// isParamsType 値が指定した型に一致するかを調べる
+func isParamsType(value interface{}, paramsType string) bool {
+	switch paramsType {
+	case ParamsTypeObject:
+		_, ok := value.(map[string]interface{})
+		return ok
+	case ParamsTypeArray:
+		_, ok := value.([]interface{})
+		return ok
+	case ParamsTypeString:
+		_, ok := value.(string)
+		return ok
+	case ParamsTypeNumber:
+		_, ok := paramsNumber(value)
+		return ok
+	case ParamsTypeInteger:
+		number, ok := paramsNumber(value)
+		return ok && number == math.Trunc(number)
+	case ParamsTypeBoolean:
+		_, ok := value.(bool)
+		return ok
+	}
+	return true
+}
+
+// paramsNumber 数値を表す値をfloat64として取得する
+// JSONから読み込んだ値はfloat64になるが、Goから直接指定された整数にも対応する
+func paramsNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case json.Number:
+		number, err := v.Float64()
+		return number, err == nil
+	}
+	return 0, false
+}
+
+func containsParamsValue(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if a, ok := paramsNumber(v); ok {
+			if b, ok := paramsNumber(value); ok && a == b {
+				return true
+			}
+			continue
+		}
+		if reflect.DeepEqual(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParamsSchemaOf パラメータの型からスキーマを作成する
+// 構造体のフィールド名は"json"タグに従い、omitemptyの指定がなくポインタでもないフィールドは必須とする
+func ParamsSchemaOf[P any]() *ParamsSchema {
+	return paramsSchemaFromType(reflect.TypeOf((*P)(nil)).Elem())
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func paramsSchemaFromType(t reflect.Type) *ParamsSchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return &ParamsSchema{Type: ParamsTypeString}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &ParamsSchema{Type: ParamsTypeString}
+	case reflect.Bool:
+		return &ParamsSchema{Type: ParamsTypeBoolean}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &ParamsSchema{Type: ParamsTypeInteger}
+	case reflect.Float32, reflect.Float64:
+		return &ParamsSchema{Type: ParamsTypeNumber}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// []byteはBase64の文字列となる
+			return &ParamsSchema{Type: ParamsTypeString}
+		}
+		return &ParamsSchema{Type: ParamsTypeArray, Items: paramsSchemaFromType(t.Elem())}
+	case reflect.Map:
+		return &ParamsSchema{Type: ParamsTypeObject}
+	case reflect.Struct:
+		schema := &ParamsSchema{Type: ParamsTypeObject, Properties: map[string]*ParamsSchema{}}
+		addStructFields(schema, t)
+		return schema
+	}
+	// interface{}などは型を検証しない
+	return &ParamsSchema{}
+}
+
+// addStructFields 構造体のフィールドをスキーマのプロパティに追加する
+// 埋め込まれた構造体のフィールドはJSONと同様に展開する
+func addStructFields(schema *ParamsSchema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				addStructFields(schema, fieldType)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		schema.Properties[name] = paramsSchemaFromType(field.Type)
+		if field.Type.Kind() != reflect.Ptr && !strings.Contains(options, "omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
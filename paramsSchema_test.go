@@ -0,0 +1,80 @@
+package gojobcoordinatortest_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/y-akahori-ramen/gojobcoordinatortest"
+)
+
+type testSchemaParams struct {
+	Name    string            `json:"name"`
+	Count   int               `json:"count,omitempty"`
+	Ratio   *float64          `json:"ratio"`
+	Tags    []string          `json:"tags,omitempty"`
+	Options map[string]string `json:"options,omitempty"`
+	Ignored string            `json:"-"`
+}
+
+func TestParamsSchemaOf(t *testing.T) {
+	schema := gojobcoordinatortest.ParamsSchemaOf[testSchemaParams]()
+	if schema.Type != gojobcoordinatortest.ParamsTypeObject || !reflect.DeepEqual(schema.Required, []string{"name"}) {
+		t.Fatalf("unexpected schema %+v", schema)
+	}
+
+	expectTypes := map[string]string{
+		"name":    gojobcoordinatortest.ParamsTypeString,
+		"count":   gojobcoordinatortest.ParamsTypeInteger,
+		"ratio":   gojobcoordinatortest.ParamsTypeNumber,
+		"tags":    gojobcoordinatortest.ParamsTypeArray,
+		"options": gojobcoordinatortest.ParamsTypeObject,
+	}
+	if len(schema.Properties) != len(expectTypes) {
+		t.Fatalf("unexpected properties %v", schema.Properties)
+	}
+	for name, paramsType := range expectTypes {
+		if schema.Properties[name].Type != paramsType {
+			t.Fatalf("%v: %v != %v", name, schema.Properties[name].Type, paramsType)
+		}
+	}
+}
+
+func TestParamsSchemaValidate(t *testing.T) {
+	minimum := 1.0
+	closed := false
+	schema := &gojobcoordinatortest.ParamsSchema{
+		Type:                 gojobcoordinatortest.ParamsTypeObject,
+		Required:             []string{"name"},
+		AdditionalProperties: &closed,
+		Properties: map[string]*gojobcoordinatortest.ParamsSchema{
+			"name":  {Type: gojobcoordinatortest.ParamsTypeString, Enum: []interface{}{"a", "b"}},
+			"count": {Type: gojobcoordinatortest.ParamsTypeInteger, Minimum: &minimum},
+			"tags":  {Type: gojobcoordinatortest.ParamsTypeArray, Items: &gojobcoordinatortest.ParamsSchema{Type: gojobcoordinatortest.ParamsTypeString}},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		params        *map[string]interface{}
+		violationsNum int
+	}{
+		{"Valid", &map[string]interface{}{"name": "a", "count": 2.0, "tags": []interface{}{"x"}}, 0},
+		{"GoInt", &map[string]interface{}{"name": "b", "count": 1}, 0},
+		{"Placeholder", &map[string]interface{}{"name": "${task.value}", "count": "${task.count}"}, 0},
+		{"Nil", nil, 1},
+		{"Enum", &map[string]interface{}{"name": "c"}, 1},
+		{"NotInteger", &map[string]interface{}{"name": "a", "count": 1.5}, 1},
+		{"Minimum", &map[string]interface{}{"name": "a", "count": 0}, 1},
+		{"Items", &map[string]interface{}{"name": "a", "tags": []interface{}{"x", 1}}, 1},
+		{"Additional", &map[string]interface{}{"name": "a", "unknown": true}, 1},
+		{"Multiple", &map[string]interface{}{"count": "1", "tags": "x"}, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			violations := schema.ValidateParams(test.params)
+			if len(violations) != test.violationsNum {
+				t.Fatalf("unexpected violations %v", violations)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package gojobcoordinatortest
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// SchedulerRoundRobin 接続しているTaskRunnerへ順番にタスクを割り当てるスケジューラー名
+	SchedulerRoundRobin string = "roundRobin"
+	// SchedulerLeastLoaded 実行中タスクの割合が最も少ないTaskRunnerへタスクを割り当てるスケジューラー名
+	SchedulerLeastLoaded string = "leastLoaded"
+	// SchedulerRandom ランダムに選んだTaskRunnerへタスクを割り当てるスケジューラー名
+	SchedulerRandom string = "random"
+)
+
+// RunnerLoad スケジューラーに渡されるTaskRunnerの負荷情報
+// ActiveTaskNum,TaskNumMaxはTaskRunnerから最後に取得した値にCoordinatorが割り当てたタスク数を反映したもの
+type RunnerLoad struct {
+	Address       string
+	ActiveTaskNum uint
+	TaskNumMax    uint
+}
+
+// Scheduler タスクを割り当てるTaskRunnerの選択戦略
+// Coordinatorから並行して呼び出されるためスレッドセーフである必要があります。
+type Scheduler interface {
+	// Name スケジューラー名。/runnersの出力に使用される
+	Name() string
+	// Order タスク開始を試みるTaskRunnerのアドレスを試す順に並べて返す
+	// 先頭から順にタスク開始を試み、TaskRunnerに拒否された場合は次のTaskRunnerを試す
+	Order(req *TaskStartRequest, runners []RunnerLoad) []string
+}
+
+// NewScheduler スケジューラー名から対応するスケジューラーを作成する
+func NewScheduler(name string) (Scheduler, error) {
+	switch name {
+	case SchedulerRoundRobin:
+		return NewRoundRobinScheduler(), nil
+	case SchedulerLeastLoaded:
+		return NewLeastLoadedScheduler(), nil
+	case SchedulerRandom:
+		return NewRandomScheduler(), nil
+	default:
+		return nil, fmt.Errorf("スケジューラー %s は存在しません", name)
+	}
+}
+
+// RoundRobinScheduler 接続しているTaskRunnerへ順番にタスクを割り当てるスケジューラー
+type RoundRobinScheduler struct {
+	next uint64
+}
+
+// NewRoundRobinScheduler RoundRobinSchedulerの作成
+func NewRoundRobinScheduler() *RoundRobinScheduler {
+	return &RoundRobinScheduler{}
+}
+
+// Name Schedulerインターフェイスの実装
+func (s *RoundRobinScheduler) Name() string {
+	return SchedulerRoundRobin
+}
+
+// Order Schedulerインターフェイスの実装
+// アドレス順に並べたTaskRunnerを、呼び出されるたびに開始位置をずらして返す
+func (s *RoundRobinScheduler) Order(req *TaskStartRequest, runners []RunnerLoad) []string {
+	addrs := runnerAddresses(runners)
+	if len(addrs) == 0 {
+		return addrs
+	}
+	sort.Strings(addrs)
+
+	start := int((atomic.AddUint64(&s.next, 1) - 1) % uint64(len(addrs)))
+	return append(addrs[start:], addrs[:start]...)
+}
+
+// LeastLoadedScheduler 実行中タスクの割合が最も少ないTaskRunnerへタスクを割り当てるスケジューラー
+type LeastLoadedScheduler struct {
+}
+
+// NewLeastLoadedScheduler LeastLoadedSchedulerの作成
+func NewLeastLoadedScheduler() *LeastLoadedScheduler {
+	return &LeastLoadedScheduler{}
+}
+
+// Name Schedulerインターフェイスの実装
+func (s *LeastLoadedScheduler) Name() string {
+	return SchedulerLeastLoaded
+}
+
+// Order Schedulerインターフェイスの実装
+// 実行中タスク数/最大タスク数の小さい順に返す。負荷情報が取得できていないTaskRunnerは最後に試す
+func (s *LeastLoadedScheduler) Order(req *TaskStartRequest, runners []RunnerLoad) []string {
+	sorted := make([]RunnerLoad, len(runners))
+	copy(sorted, runners)
+
+	loadRate := func(runner RunnerLoad) float64 {
+		if runner.TaskNumMax == 0 {
+			return 1
+		}
+		return float64(runner.ActiveTaskNum) / float64(runner.TaskNumMax)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		rateI, rateJ := loadRate(sorted[i]), loadRate(sorted[j])
+		if rateI != rateJ {
+			return rateI < rateJ
+		}
+		return sorted[i].Address < sorted[j].Address
+	})
+
+	return runnerAddresses(sorted)
+}
+
+// RandomScheduler ランダムに選んだTaskRunnerへタスクを割り当てるスケジューラー
+// 選んだTaskRunnerに拒否された場合は残りのTaskRunnerからランダムに選び直す
+type RandomScheduler struct {
+	randLock sync.Mutex
+	rand     *rand.Rand
+}
+
+// NewRandomScheduler RandomSchedulerの作成
+func NewRandomScheduler() *RandomScheduler {
+	return &RandomScheduler{rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+// Name Schedulerインターフェイスの実装
+func (s *RandomScheduler) Name() string {
+	return SchedulerRandom
+}
+
+// Order Schedulerインターフェイスの実装
+func (s *RandomScheduler) Order(req *TaskStartRequest, runners []RunnerLoad) []string {
+	addrs := runnerAddresses(runners)
+
+	s.randLock.Lock()
+	defer s.randLock.Unlock()
+	s.rand.Shuffle(len(addrs), func(i, j int) {
+		addrs[i], addrs[j] = addrs[j], addrs[i]
+	})
+	return addrs
+}
+
+func runnerAddresses(runners []RunnerLoad) []string {
+	addrs := make([]string, 0, len(runners))
+	for _, runner := range runners {
+		addrs = append(addrs, runner.Address)
+	}
+	return addrs
+}
@@ -0,0 +1,55 @@
+package gojobcoordinatortest_test
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/y-akahori-ramen/gojobcoordinatortest"
+)
+
+var testRunnerLoads = []gojobcoordinatortest.RunnerLoad{
+	{Address: "http://c", ActiveTaskNum: 1, TaskNumMax: 4},
+	{Address: "http://a", ActiveTaskNum: 2, TaskNumMax: 2},
+	{Address: "http://b", ActiveTaskNum: 0, TaskNumMax: 2},
+	{Address: "http://d"},
+}
+
+func TestRoundRobinScheduler(t *testing.T) {
+	scheduler := gojobcoordinatortest.NewRoundRobinScheduler()
+	req := &gojobcoordinatortest.TaskStartRequest{}
+
+	expects := [][]string{
+		{"http://a", "http://b", "http://c", "http://d"},
+		{"http://b", "http://c", "http://d", "http://a"},
+		{"http://c", "http://d", "http://a", "http://b"},
+		{"http://d", "http://a", "http://b", "http://c"},
+		{"http://a", "http://b", "http://c", "http://d"},
+	}
+	for _, expect := range expects {
+		if order := scheduler.Order(req, testRunnerLoads); !reflect.DeepEqual(order, expect) {
+			t.Fatalf("%v != %v", order, expect)
+		}
+	}
+}
+
+func TestLeastLoadedScheduler(t *testing.T) {
+	scheduler := gojobcoordinatortest.NewLeastLoadedScheduler()
+
+	expect := []string{"http://b", "http://c", "http://a", "http://d"}
+	if order := scheduler.Order(&gojobcoordinatortest.TaskStartRequest{}, testRunnerLoads); !reflect.DeepEqual(order, expect) {
+		t.Fatalf("%v != %v", order, expect)
+	}
+}
+
+func TestRandomScheduler(t *testing.T) {
+	scheduler := gojobcoordinatortest.NewRandomScheduler()
+
+	// 順番は不定だが全TaskRunnerが1回ずつ含まれる
+	order := scheduler.Order(&gojobcoordinatortest.TaskStartRequest{}, testRunnerLoads)
+	sort.Strings(order)
+	expect := []string{"http://a", "http://b", "http://c", "http://d"}
+	if !reflect.DeepEqual(order, expect) {
+		t.Fatalf("%v != %v", order, expect)
+	}
+}
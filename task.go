@@ -3,19 +3,43 @@ package gojobcoordinatortest
 import (
 	"context"
 	"log"
+	"time"
 )
 
 // TaskResult タスク処理結果
+// Cancelledはキャンセルにより中断したこと、TimedOutは制限時間を過ぎて中断したことを表す
+// Successがfalseでどちらも指定されていない場合は、TaskRunnerがタスクに渡したctxの状態から判定する
 type TaskResult struct {
 	ID           string
 	Success      bool
+	Cancelled    bool
+	TimedOut     bool
 	ResultValues *map[string]interface{}
 }
 
 // Task タスクインターフェイス
+// 新しいタスクはTaskContextを受け取るTaskV2での実装を推奨します。TaskはTaskRunner内でAdaptTaskによりTaskV2として実行されます。
+// Runは戻る前にdoneへ結果を1つ送る必要があります。結果を送らずに戻った場合やpanicが発生した場合、タスクは失敗として扱われます。
+// 制限時間がある場合はctxに期限が設定され、期限を過ぎるとctxが終了します。
+// 実行中の進捗はctxを指定してReportProgressで報告できます。
 type Task interface {
 	Run(ctx context.Context, taskID string, logger *log.Logger, done chan<- *TaskResult)
 }
 
 // TaskFactoryFunc タスク生成関数の型
 type TaskFactoryFunc func(req *TaskStartRequest) (Task, error)
+
+// TaskFactoryOptions タスクファクトリ登録時の設定項目
+// MaxRuntime タスクの最大実行時間。超えた場合はタスクをキャンセルして制限時間切れとして扱う。0の場合は制限しない。
+// ParamsSchema タスクのパラメータのスキーマ。指定した場合はタスク開始前にパラメータを検証し、Coordinatorもジョブ開始時に検証する。nilの場合は検証しない。
+type TaskFactoryOptions struct {
+	MaxRuntime   time.Duration
+	ParamsSchema *ParamsSchema
+}
+
+// taskFactory TaskRunnerに登録されたタスクファクトリと設定
+// 従来のTaskFactoryFuncはTaskV2を生成する関数に変換して保持する
+type taskFactory struct {
+	f       TaskV2FactoryFunc
+	options TaskFactoryOptions
+}
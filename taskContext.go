@@ -0,0 +1,301 @@
+package gojobcoordinatortest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TaskV2 第2世代のタスクインターフェイス
+// Runは結果値かエラーを返す。エラーを返した場合はタスクの失敗として扱い、結果値がある場合はそれも保持する
+// context.Canceled,context.DeadlineExceededを返した場合や、ctxが終了してエラーを返した場合はキャンセルか制限時間切れとして扱う
+// 従来のTaskはAdaptTaskでTaskV2として実行できる
+type TaskV2 interface {
+	Run(tc TaskContext) (map[string]interface{}, error)
+}
+
+// TaskV2FactoryFunc TaskV2の生成関数の型
+type TaskV2FactoryFunc func(req *TaskStartRequest) (TaskV2, error)
+
+// TaskContext TaskV2の実行時に渡される、タスクの実行に必要な情報と機能
+// Contextはキャンセルや制限時間で終了するcontext、Loggerはタスクのログへ出力する構造化ロガーを返す
+// ReportProgressは進捗を報告し、DecodeParamsはパラメータを構造体へ変換する
+// WorkDirはタスクごとの一時作業ディレクトリを返す。初めて呼ばれた時に作成され、Runから戻った後に削除される
+type TaskContext interface {
+	Context() context.Context
+	TaskID() string
+	Metadata() TaskMetadata
+	Logger() *TaskLogger
+	Params() *map[string]interface{}
+	DecodeParams(v interface{}) error
+	ReportProgress(progress TaskProgress)
+	WorkDir() (string, error)
+}
+
+// TaskMetadata タスクの実行に関する情報
+// JobID,TaskIndex,AttemptはCoordinatorから開始された場合にジョブID、ジョブ内のタスクの位置、1から始まる試行回数が入る
+// DeadlineにはタスクのContextの期限が入る。制限時間がない場合はnilとなる
+type TaskMetadata struct {
+	TaskID    string
+	ProcName  string
+	JobID     string
+	TaskIndex int
+	Attempt   int
+	StartedAt time.Time
+	Deadline  *time.Time
+}
+
+// taskContext TaskRunnerがTaskV2へ渡すTaskContextの実装
+type taskContext struct {
+	ctx         context.Context
+	metadata    TaskMetadata
+	logger      *TaskLogger
+	params      *map[string]interface{}
+	workDirRoot string
+	workDirLock sync.Mutex
+	workDir     string
+}
+
+func newTaskContext(ctx context.Context, taskID string, req TaskStartRequest, logger *log.Logger, workDirRoot string) *taskContext {
+	metadata := TaskMetadata{TaskID: taskID, ProcName: req.ProcName, JobID: req.JobID, TaskIndex: req.TaskIndex, Attempt: req.Attempt, StartedAt: time.Now()}
+	if deadline, ok := ctx.Deadline(); ok {
+		metadata.Deadline = &deadline
+	}
+	return &taskContext{ctx: ctx, metadata: metadata, logger: NewTaskLogger(logger), params: req.Params, workDirRoot: workDirRoot}
+}
+
+func (tc *taskContext) Context() context.Context {
+	return tc.ctx
+}
+
+func (tc *taskContext) TaskID() string {
+	return tc.metadata.TaskID
+}
+
+func (tc *taskContext) Metadata() TaskMetadata {
+	return tc.metadata
+}
+
+func (tc *taskContext) Logger() *TaskLogger {
+	return tc.logger
+}
+
+func (tc *taskContext) Params() *map[string]interface{} {
+	return tc.params
+}
+
+// DecodeParams パラメータを構造体へ変換する。パラメータがない場合は何もしない
+func (tc *taskContext) DecodeParams(v interface{}) error {
+	if tc.params == nil {
+		return nil
+	}
+	if err := MapToStruct(*tc.params, v); err != nil {
+		return fmt.Errorf("%sのパラメータが不正です:%s", tc.metadata.ProcName, err.Error())
+	}
+	return nil
+}
+
+func (tc *taskContext) ReportProgress(progress TaskProgress) {
+	ReportProgress(tc.ctx, progress)
+}
+
+func (tc *taskContext) WorkDir() (string, error) {
+	tc.workDirLock.Lock()
+	defer tc.workDirLock.Unlock()
+
+	if tc.workDir == "" {
+		dir, err := os.MkdirTemp(tc.workDirRoot, fmt.Sprint("task-", tc.metadata.TaskID, "-"))
+		if err != nil {
+			return "", fmt.Errorf("作業ディレクトリの作成に失敗しました:%s", err.Error())
+		}
+		tc.workDir = dir
+	}
+	return tc.workDir, nil
+}
+
+// removeWorkDir 作業ディレクトリが作成されていれば削除する
+func (tc *taskContext) removeWorkDir() {
+	tc.workDirLock.Lock()
+	defer tc.workDirLock.Unlock()
+
+	if tc.workDir == "" {
+		return
+	}
+	if err := os.RemoveAll(tc.workDir); err != nil {
+		tc.logger.Warn("作業ディレクトリの削除に失敗しました", "dir", tc.workDir, "error", err)
+	}
+	tc.workDir = ""
+}
+
+// TaskLogger タスクのログへ構造化したログを出力するロガー
+// ログは level=INFO msg=メッセージ キー=値 の形式で出力される
+type TaskLogger struct {
+	logger *log.Logger
+	fields []interface{}
+}
+
+// NewTaskLogger 出力先のロガーを指定してTaskLoggerを作成する
+func NewTaskLogger(logger *log.Logger) *TaskLogger {
+	return &TaskLogger{logger: logger}
+}
+
+// With 指定したキーと値を常に出力するロガーを作成する
+func (l *TaskLogger) With(keysAndValues ...interface{}) *TaskLogger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keysAndValues))
+	fields = append(append(fields, l.fields...), keysAndValues...)
+	return &TaskLogger{logger: l.logger, fields: fields}
+}
+
+// Info 情報を出力する。keysAndValuesにはキーと値を交互に指定する
+func (l *TaskLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.output("INFO", msg, keysAndValues)
+}
+
+// Warn 警告を出力する。keysAndValuesにはキーと値を交互に指定する
+func (l *TaskLogger) Warn(msg string, keysAndValues ...interface{}) {
+	l.output("WARN", msg, keysAndValues)
+}
+
+// Error エラーを出力する。keysAndValuesにはキーと値を交互に指定する
+func (l *TaskLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.output("ERROR", msg, keysAndValues)
+}
+
+// StdLogger 出力先のロガーを取得する
+func (l *TaskLogger) StdLogger() *log.Logger {
+	return l.logger
+}
+
+func (l *TaskLogger) output(level, msg string, keysAndValues []interface{}) {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "level=%s msg=%s", level, formatLogValue(msg))
+
+	fields := append(append([]interface{}{}, l.fields...), keysAndValues...)
+	for i := 0; i < len(fields); i += 2 {
+		if i+1 >= len(fields) {
+			// 値のないキーは値として出力する
+			fmt.Fprintf(&builder, " !BADKEY=%s", formatLogValue(fields[i]))
+			break
+		}
+		fmt.Fprintf(&builder, " %v=%s", fields[i], formatLogValue(fields[i+1]))
+	}
+	l.logger.Print(builder.String())
+}
+
+// formatLogValue ログに出力する値を文字列にする。空白などを含む場合は引用符で囲む
+func formatLogValue(value interface{}) string {
+	str := fmt.Sprint(value)
+	if str == "" || strings.ContainsAny(str, " =\"\t\r\n") {
+		return strconv.Quote(str)
+	}
+	return str
+}
+
+// taskPanicError タスクでpanicが発生したことを表すエラー
+// キャンセル中に発生したものでも失敗として扱う
+type taskPanicError struct {
+	value interface{}
+}
+
+func (e *taskPanicError) Error() string {
+	return fmt.Sprint("タスクでpanicが発生しました:", e.value)
+}
+
+var (
+	// errTaskNoResult 従来のTaskが結果を送らずにRunから戻った時のエラー
+	errTaskNoResult = errors.New("タスクが結果を送らずに終了しました")
+	// errTaskNilResult 従来のTaskが空の結果を送った時のエラー
+	errTaskNilResult = errors.New("タスクが空の結果を送りました")
+	// errTaskFailed 従来のTaskが失敗の結果を送った時のエラー
+	errTaskFailed = errors.New("タスクが失敗しました")
+)
+
+// AdaptTask 従来のTaskをTaskV2として実行するためのアダプタを作成する
+// 結果がdoneへ送られた後はRunが戻るまで待ってから結果を返す。contextが終了した場合はRunの終了を待たない
+// 結果のCancelled,TimedOutはそれぞれcontext.Canceled,context.DeadlineExceededのエラーとして返す
+func AdaptTask(task Task) TaskV2 {
+	return &legacyTask{task: task}
+}
+
+// legacyTask 従来のTaskをTaskV2として実行する
+type legacyTask struct {
+	task Task
+}
+
+func (task *legacyTask) Run(tc TaskContext) (map[string]interface{}, error) {
+	logger := tc.Logger().StdLogger()
+	done := make(chan *TaskResult, 1)
+	returned := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Printf("タスクでpanicが発生しました:%v\n%s", r, debug.Stack())
+				returned <- &taskPanicError{value: r}
+				return
+			}
+			returned <- nil
+		}()
+		task.task.Run(tc.Context(), tc.TaskID(), logger, done)
+	}()
+
+	var result *TaskResult
+	select {
+	case result = <-done:
+	case err := <-returned:
+		// 戻る直前に送られた結果があればそれを使用する
+		select {
+		case result := <-done:
+			return legacyTaskOutput(result)
+		default:
+		}
+		if err != nil {
+			return nil, err
+		}
+		return nil, errTaskNoResult
+	}
+
+	// 結果を受け取った後もRunが戻るまで待つ
+	// 余分に送られた結果は読み捨て、goroutineがdoneへの送信で止まらないようにする
+	for {
+		select {
+		case <-returned:
+			return legacyTaskOutput(result)
+		case <-done:
+		case <-tc.Context().Done():
+			select {
+			case <-done:
+			default:
+			}
+			return legacyTaskOutput(result)
+		}
+	}
+}
+
+// legacyTaskOutput 従来のTaskの結果をTaskV2の結果値とエラーに変換する
+func legacyTaskOutput(result *TaskResult) (map[string]interface{}, error) {
+	if result == nil {
+		return nil, errTaskNilResult
+	}
+
+	var values map[string]interface{}
+	if result.ResultValues != nil {
+		values = *result.ResultValues
+	}
+	switch {
+	case result.Success:
+		return values, nil
+	case result.TimedOut:
+		return values, context.DeadlineExceeded
+	case result.Cancelled:
+		return values, context.Canceled
+	default:
+		return values, errTaskFailed
+	}
+}
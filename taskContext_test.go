@@ -0,0 +1,111 @@
+package gojobcoordinatortest_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/y-akahori-ramen/gojobcoordinatortest"
+)
+
+// testFuncTaskV2 関数をRunとして実行するTaskV2
+type testFuncTaskV2 func(tc gojobcoordinatortest.TaskContext) (map[string]interface{}, error)
+
+func (task testFuncTaskV2) Run(tc gojobcoordinatortest.TaskContext) (map[string]interface{}, error) {
+	return task(tc)
+}
+
+func TestTaskV2(t *testing.T) {
+	workDirRoot := t.TempDir()
+	runner := gojobcoordinatortest.NewTaskRunner(gojobcoordinatortest.TaskRunnerConfig{TaskNumMax: 1, WorkDirRoot: workDirRoot})
+
+	var metadata gojobcoordinatortest.TaskMetadata
+	var workDir string
+	runner.AddFactoryV2("V2", func(req *gojobcoordinatortest.TaskStartRequest) (gojobcoordinatortest.TaskV2, error) {
+		return testFuncTaskV2(func(tc gojobcoordinatortest.TaskContext) (map[string]interface{}, error) {
+			metadata = tc.Metadata()
+			var params struct {
+				Value string `json:"value"`
+			}
+			if err := tc.DecodeParams(&params); err != nil {
+				return nil, err
+			}
+
+			dir, err := tc.WorkDir()
+			if err != nil {
+				return nil, err
+			}
+			workDir = dir
+			if err := os.WriteFile(filepath.Join(dir, "out.txt"), []byte(params.Value), 0o644); err != nil {
+				return nil, err
+			}
+			tc.Logger().Info("書き込みました", "value", params.Value)
+
+			if params.Value == "cancel" {
+				return nil, context.Canceled
+			}
+			if params.Value == "" {
+				return map[string]interface{}{"reason": "empty"}, errors.New("値が空です")
+			}
+			return map[string]interface{}{"value": params.Value}, nil
+		}), nil
+	})
+
+	start := func(value string) gojobcoordinatortest.TaskStatusResponse {
+		params := map[string]interface{}{"value": value}
+		resp, err := runner.Start(gojobcoordinatortest.TaskStartRequest{ProcName: "V2", Params: &params, JobID: "job", TaskIndex: 1, Attempt: 2, TimeoutSec: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitRunnerTaskComplete(t, runner, resp.ID, time.Second*5)
+		status, err := runner.GetTaskStatusResponse(resp.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return status
+	}
+
+	status := start("hello")
+	if status.Status != gojobcoordinatortest.StatusSuccess || (*status.ResultValues)["value"] != "hello" {
+		t.Fatalf("unexpected status %v", status)
+	}
+	if metadata.TaskID != status.ID || metadata.ProcName != "V2" || metadata.JobID != "job" || metadata.TaskIndex != 1 || metadata.Attempt != 2 || metadata.Deadline == nil {
+		t.Fatalf("unexpected metadata %v", metadata)
+	}
+	// 作業ディレクトリは指定した親ディレクトリに作成され、タスク完了後に削除される
+	if filepath.Dir(workDir) != workDirRoot {
+		t.Fatalf("unexpected work dir %v", workDir)
+	}
+	if _, err := os.Stat(workDir); !os.IsNotExist(err) {
+		t.Fatalf("work dir is not removed %v", err)
+	}
+
+	// エラーを返した場合は失敗となり、結果値は保持される
+	status = start("")
+	if status.Status != gojobcoordinatortest.StatusFailure || (*status.ResultValues)["reason"] != "empty" {
+		t.Fatalf("unexpected status %v", status)
+	}
+
+	// context.Canceledを返した場合はキャンセルとなる
+	if status := start("cancel"); status.Status != gojobcoordinatortest.StatusCancelled {
+		t.Fatalf("unexpected status %v", status)
+	}
+}
+
+func TestTaskLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := gojobcoordinatortest.NewTaskLogger(log.New(&buf, "", 0)).With("task", "t1")
+
+	logger.Info("開始", "count", 3, "name", "a b")
+	logger.Error("失敗", "orphan")
+
+	expected := "level=INFO msg=開始 task=t1 count=3 name=\"a b\"\nlevel=ERROR msg=失敗 task=t1 !BADKEY=orphan\n"
+	if buf.String() != expected {
+		t.Fatalf("unexpected log %q", buf.String())
+	}
+}
@@ -0,0 +1,89 @@
+package gojobcoordinatortest
+
+import (
+	"context"
+	"time"
+)
+
+// progressCallbackInterval 完了通知先へ進捗を送る最小間隔
+// 間隔内に報告された進捗は最後のものだけをまとめて送る
+const progressCallbackInterval = time.Second * 5
+
+// progressReporterKey タスクに渡すctxに進捗の報告先を保持するためのキー
+type progressReporterKey struct{}
+
+// ReportProgress タスクの進捗を報告する
+// TaskのRunに渡されたctxを指定する。報告した進捗はタスクの状態のProgressで取得でき、完了通知先にも送られる
+// Fractionは0から1までの範囲に丸められる。ctxが進捗の報告先を持たない場合は何もせずfalseを返す
+func ReportProgress(ctx context.Context, progress TaskProgress) bool {
+	report, ok := ctx.Value(progressReporterKey{}).(func(TaskProgress))
+	if !ok {
+		return false
+	}
+	report(progress)
+	return true
+}
+
+// reportProgress タスクから報告された進捗を保持し、完了通知先の指定があれば送る
+// 完了したタスクの進捗は更新しない
+func (runner *TaskRunner) reportProgress(taskID string, status *taskStatus, progress TaskProgress) {
+	if progress.Fraction < 0 {
+		progress.Fraction = 0
+	} else if progress.Fraction > 1 {
+		progress.Fraction = 1
+	}
+	progress.UpdatedAt = time.Now()
+
+	status.resultLock.Lock()
+	if status.result != nil {
+		status.resultLock.Unlock()
+		return
+	}
+	status.progress = &progress
+	send := status.reqData.CallbackURL != "" && !status.progressSending
+	if send {
+		status.progressSending = true
+	}
+	wait := progressCallbackInterval - time.Since(status.progressSentAt)
+	status.resultLock.Unlock()
+
+	if send {
+		go runner.sendProgress(taskID, status, wait)
+	}
+}
+
+// sendProgress wait待ってから最新の進捗を完了通知先へ送る
+// 進捗の送信は完了通知と異なり、失敗しても再送しない
+func (runner *TaskRunner) sendProgress(taskID string, status *taskStatus, wait time.Duration) {
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+
+	status.resultLock.Lock()
+	status.progressSending = false
+	status.progressSentAt = time.Now()
+	finished := status.result != nil
+	status.resultLock.Unlock()
+	if finished {
+		return
+	}
+
+	response, err := runner.GetTaskStatusResponse(taskID)
+	if err != nil || response.Status != StatusBusy {
+		return
+	}
+	if err := postJSON(status.reqData.CallbackURL, response); err != nil {
+		runner.newTaskLogger(taskID).Printf("進捗の通知に失敗しました URL:%v %v\n", status.reqData.CallbackURL, err)
+	}
+}
+
+func (task *taskStatus) getProgress() *TaskProgress {
+	task.resultLock.Lock()
+	defer task.resultLock.Unlock()
+
+	if task.progress == nil {
+		return nil
+	}
+	progress := *task.progress
+	return &progress
+}
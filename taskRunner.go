@@ -2,9 +2,15 @@ package gojobcoordinatortest
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/url"
+	"runtime/debug"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -12,15 +18,20 @@ import (
 // TaskRunnerConfig タスクランナーの設定項目
 // TaskNumMax タスク同時実行最大数
 // Handler タスクのログ出力ハンドリング。不要な場合はnilを指定する。
+// Labels Coordinatorがタスクの割り当て先を選ぶ際に使用するラベル (例)"os":"linux"
+// Version Coordinatorへ通知するタスクランナーのバージョン。空の場合はビルド情報のメインモジュールのバージョンを使用する。
+// WorkDirRoot TaskContextのWorkDirで作成する作業ディレクトリの親ディレクトリ。空の場合はOSの一時ディレクトリを使用する。
 type TaskRunnerConfig struct {
-	TaskNumMax uint
-	Handler    LogHandler
+	TaskNumMax  uint
+	Handler     LogHandler
+	Labels      map[string]string
+	Version     string
+	WorkDirRoot string
 }
 
 // TaskRunner タスクの実行管理を行う
 type TaskRunner struct {
 	TaskRunnerConfig
-	resultDone        chan *TaskResult
 	taskStatuses      sync.Map
 	taskFactories     sync.Map
 	activeTaskNumLock sync.Mutex
@@ -29,11 +40,43 @@ type TaskRunner struct {
 
 // NewTaskRunner TaskRunnerの作成
 func NewTaskRunner(config TaskRunnerConfig) *TaskRunner {
-	return &TaskRunner{TaskRunnerConfig: config, resultDone: make(chan *TaskResult)}
+	if config.Version == "" {
+		if info, ok := debug.ReadBuildInfo(); ok {
+			config.Version = info.Main.Version
+		}
+	}
+	return &TaskRunner{TaskRunnerConfig: config}
 }
 
 // AddFactory タスクファクトリーの登録
 func (runner *TaskRunner) AddFactory(procName string, f TaskFactoryFunc) error {
+	return runner.AddFactoryWithOptions(procName, f, TaskFactoryOptions{})
+}
+
+// AddFactoryWithOptions 設定を指定してタスクファクトリーを登録する
+// 生成されたTaskはAdaptTaskでTaskV2として実行される
+func (runner *TaskRunner) AddFactoryWithOptions(procName string, f TaskFactoryFunc, options TaskFactoryOptions) error {
+	if f == nil {
+		return fmt.Errorf("%sに登録されるファクトリがnilです", procName)
+	}
+
+	factory := func(req *TaskStartRequest) (TaskV2, error) {
+		task, err := f(req)
+		if err != nil {
+			return nil, err
+		}
+		return AdaptTask(task), nil
+	}
+	return runner.AddFactoryV2WithOptions(procName, factory, options)
+}
+
+// AddFactoryV2 TaskV2のタスクファクトリーの登録
+func (runner *TaskRunner) AddFactoryV2(procName string, f TaskV2FactoryFunc) error {
+	return runner.AddFactoryV2WithOptions(procName, f, TaskFactoryOptions{})
+}
+
+// AddFactoryV2WithOptions 設定を指定してTaskV2のタスクファクトリーを登録する
+func (runner *TaskRunner) AddFactoryV2WithOptions(procName string, f TaskV2FactoryFunc, options TaskFactoryOptions) error {
 	_, exist := runner.taskFactories.Load(procName)
 	if exist {
 		return fmt.Errorf("%sに対応するファクトリはすでに登録されています", procName)
@@ -42,50 +85,39 @@ func (runner *TaskRunner) AddFactory(procName string, f TaskFactoryFunc) error {
 	if f == nil {
 		return fmt.Errorf("%sに登録されるファクトリがnilです", procName)
 	}
-	runner.taskFactories.Store(procName, f)
+	runner.taskFactories.Store(procName, &taskFactory{f: f, options: options})
 	return nil
 }
 
 // Run タスクランナー起動
+// タスクの完了はタスクごとに処理されるため、Runの開始前に完了したタスクの結果も反映される
+// ctxが終了するまで待ち、終了したら戻る
 func (runner *TaskRunner) Run(ctx context.Context) {
-	for {
-		select {
-		case result := <-runner.resultDone:
-			runner.newTaskLogger(result.ID).Printf("Complete Task. Success:%v ReturnValues:%v\n", result.Success, result.ResultValues)
-			task, err := runner.getTaskStatus(result.ID)
-			if err != nil {
-				log.Print(err.Error())
-			} else {
-				task.result = result
-			}
-
-			runner.activeTaskNumLock.Lock()
-			runner.activeTaskNum--
-			runner.activeTaskNumLock.Unlock()
-		case <-ctx.Done():
-			log.Print("TaskRunnerを停止します")
-			return
-		default:
-		}
-	}
+	<-ctx.Done()
+	log.Print("TaskRunnerを停止します")
 }
 
 // Start タスクを開始する
+// タスク開始を拒否した場合は拒否理由を持つ*TaskStartErrorを返す
 func (runner *TaskRunner) Start(req TaskStartRequest) (TaskStartResponse, error) {
 
 	runner.activeTaskNumLock.Lock()
 	defer runner.activeTaskNumLock.Unlock()
 
-	if runner.activeTaskNum >= runner.TaskNumMax {
-		return TaskStartResponse{}, fmt.Errorf("タスク実行数が上限に達しています Max:%d", runner.TaskNumMax)
-	}
-
 	// タスク作成
-	task, err := runner.newTask(&req)
+	// パラメータの誤りは再試行しても解消しないため、実行数の上限に関わらず先に確認する
+	if err := validateCallbackURL(req.CallbackURL); err != nil {
+		return TaskStartResponse{}, &TaskStartError{Reason: TaskStartRejectInvalidParams, Message: err.Error()}
+	}
+	task, options, err := runner.newTask(&req)
 	if err != nil {
 		return TaskStartResponse{}, err
 	}
 
+	if runner.activeTaskNum >= runner.TaskNumMax {
+		return TaskStartResponse{}, &TaskStartError{Reason: TaskStartRejectCapacity, Message: fmt.Sprintf("タスク実行数が上限に達しています Max:%d", runner.TaskNumMax)}
+	}
+
 	// タスクID割り振り
 	id, err := uuid.NewRandom()
 	if err != nil {
@@ -94,22 +126,153 @@ func (runner *TaskRunner) Start(req TaskStartRequest) (TaskStartResponse, error)
 	taskID := id.String()
 
 	// タスク状態管理情報の作成
-	ctx, cancel := context.WithCancel(context.Background())
-	runner.taskStatuses.Store(taskID, &taskStatus{reqData: req, result: nil, cancel: cancel})
+	// 制限時間がある場合はタスクに渡すctxに期限を設定する
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if deadline, ok := taskDeadline(req, options.MaxRuntime); ok {
+		ctx, cancel = context.WithDeadline(context.Background(), deadline)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	status := &taskStatus{reqData: req, result: nil, cancel: cancel}
+	runner.taskStatuses.Store(taskID, status)
+	// タスクからReportProgressで進捗を報告できるようにする
+	ctx = context.WithValue(ctx, progressReporterKey{}, func(progress TaskProgress) {
+		runner.reportProgress(taskID, status, progress)
+	})
 
 	// タスク実行数を加算
 	runner.activeTaskNum++
 
 	// タスク実行
-	// タスクが完了すればresultDoneチャネルに結果が送られる
+	// タスクが完了すればrunTaskで結果が反映される
 	// タスクをキャンセルする場合はtaskStatusesに保存しているキャンセル関数を呼ぶ
 	taskLogger := runner.newTaskLogger(taskID)
 	taskLogger.Printf("Start Task. ProcName:%v Params:%v\n", req.ProcName, req.Params)
-	go task.Run(ctx, taskID, taskLogger, runner.resultDone)
+	tc := newTaskContext(ctx, taskID, req, taskLogger, runner.WorkDirRoot)
+	go runner.runTask(tc, cancel, task)
 
 	return TaskStartResponse{ID: taskID}, nil
 }
 
+// taskDeadline タスク開始リクエストの制限時間とファクトリの最大実行時間のうち最も早い期限を求める
+// 制限時間がない場合はfalseを返す
+func taskDeadline(req TaskStartRequest, maxRuntime time.Duration) (time.Time, bool) {
+	var deadline time.Time
+	setEarlier := func(t time.Time) {
+		if deadline.IsZero() || t.Before(deadline) {
+			deadline = t
+		}
+	}
+
+	now := time.Now()
+	if req.Deadline != nil {
+		setEarlier(*req.Deadline)
+	}
+	if req.TimeoutSec > 0 {
+		setEarlier(now.Add(time.Duration(req.TimeoutSec * float64(time.Second))))
+	}
+	if maxRuntime > 0 {
+		setEarlier(now.Add(maxRuntime))
+	}
+	return deadline, !deadline.IsZero()
+}
+
+// runTask タスクを実行し、完了したら結果を反映する
+// Runでpanicが発生した場合は失敗として扱う。作業ディレクトリはRunから戻った後に削除する
+// ctxの期限を過ぎた場合はRunの終了を待たずにキャンセルする
+func (runner *TaskRunner) runTask(tc *taskContext, cancel context.CancelFunc, task TaskV2) {
+	defer cancel()
+	ctx, taskID, logger := tc.Context(), tc.TaskID(), tc.Logger().StdLogger()
+
+	type taskOutput struct {
+		values map[string]interface{}
+		err    error
+	}
+	done := make(chan taskOutput, 1)
+	go func() {
+		defer tc.removeWorkDir()
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Printf("タスクでpanicが発生しました:%v\n%s", r, debug.Stack())
+				done <- taskOutput{err: &taskPanicError{value: r}}
+			}
+		}()
+		values, err := task.Run(tc)
+		done <- taskOutput{values: values, err: err}
+	}()
+
+	var timeout <-chan time.Time
+	deadline, hasDeadline := ctx.Deadline()
+	if hasDeadline {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var result *TaskResult
+	select {
+	case output := <-done:
+		result = newTaskResult(ctx, taskID, output.values, output.err, logger)
+	case <-timeout:
+		logger.Printf("制限時刻%vを過ぎたためタスクをキャンセルします", deadline.Format(time.RFC3339))
+		cancel()
+		result = &TaskResult{ID: taskID, Success: false, TimedOut: true}
+	}
+	runner.completeTask(taskID, result, logger)
+}
+
+// newTaskResult タスクが返した結果値とエラーからタスクの結果を作成する
+// context.Canceled,context.DeadlineExceededのエラーはキャンセル、制限時間切れとして扱う
+// それ以外のエラーは、ctxが期限切れなら制限時間切れ、キャンセルされていればキャンセルとして扱う
+// panicはキャンセル中に発生したものでも失敗として扱う
+func newTaskResult(ctx context.Context, taskID string, values map[string]interface{}, err error, logger *log.Logger) *TaskResult {
+	result := &TaskResult{ID: taskID, Success: err == nil}
+	if values != nil {
+		result.ResultValues = &values
+	}
+	if err == nil {
+		return result
+	}
+
+	var panicErr *taskPanicError
+	switch {
+	case errors.As(err, &panicErr):
+		// panicは発生時にスタックトレースと共に出力済み
+		return result
+	case errors.Is(err, context.DeadlineExceeded):
+		result.TimedOut = true
+	case errors.Is(err, context.Canceled):
+		result.Cancelled = true
+	case ctx.Err() == context.DeadlineExceeded:
+		result.TimedOut = true
+	case ctx.Err() == context.Canceled:
+		result.Cancelled = true
+	}
+	if !errors.Is(err, errTaskFailed) {
+		logger.Printf("タスクが失敗しました:%v", err)
+	}
+	return result
+}
+
+// completeTask タスクの結果を反映し、完了通知と実行数の減算を行う
+func (runner *TaskRunner) completeTask(taskID string, result *TaskResult, logger *log.Logger) {
+	logger.Printf("Complete Task. Success:%v Cancelled:%v TimedOut:%v ReturnValues:%v\n", result.Success, result.Cancelled, result.TimedOut, result.ResultValues)
+	task, err := runner.getTaskStatus(taskID)
+	if err != nil {
+		log.Print(err.Error())
+	} else {
+		task.setResult(result)
+		if task.reqData.CallbackURL != "" {
+			go runner.sendCallback(taskID, task.reqData.CallbackURL)
+		}
+	}
+
+	runner.activeTaskNumLock.Lock()
+	runner.activeTaskNum--
+	runner.activeTaskNumLock.Unlock()
+}
+
 // CancelReq 指定したタスクにキャンセルリクエストを行う
 func (runner *TaskRunner) CancelReq(taskID string) error {
 	task, err := runner.getTaskStatus(taskID)
@@ -130,7 +293,7 @@ func (runner *TaskRunner) Delete(taskID string) error {
 		return err
 	}
 
-	if task.result == nil {
+	if task.getResult() == nil {
 		return fmt.Errorf("実行中タスクは削除できません:%s", taskID)
 	}
 
@@ -149,6 +312,53 @@ func (runner *TaskRunner) GetTaskIDs() []string {
 	return tasks
 }
 
+// GetProcNames 登録されているタスクファクトリの処理名一覧を取得する
+func (runner *TaskRunner) GetProcNames() []string {
+	var procs []string
+	addProc := func(procName, _ interface{}) bool {
+		procs = append(procs, procName.(string))
+		return true
+	}
+	runner.taskFactories.Range(addProc)
+	sort.Strings(procs)
+	return procs
+}
+
+// GetStats 負荷状況の取得
+func (runner *TaskRunner) GetStats() TaskRunnerStatsResponse {
+	runner.activeTaskNumLock.Lock()
+	defer runner.activeTaskNumLock.Unlock()
+
+	return TaskRunnerStatsResponse{ActiveTaskNum: runner.activeTaskNum, TaskNumMax: runner.TaskNumMax}
+}
+
+// GetLabels 設定されているラベルを取得する
+func (runner *TaskRunner) GetLabels() map[string]string {
+	labels := make(map[string]string, len(runner.Labels))
+	for key, value := range runner.Labels {
+		labels[key] = value
+	}
+	return labels
+}
+
+// GetParamsSchemas スキーマが登録されている処理名ごとのパラメータのスキーマを取得する
+func (runner *TaskRunner) GetParamsSchemas() map[string]*ParamsSchema {
+	schemas := map[string]*ParamsSchema{}
+	addSchema := func(procName, value interface{}) bool {
+		if schema := value.(*taskFactory).options.ParamsSchema; schema != nil {
+			schemas[procName.(string)] = schema
+		}
+		return true
+	}
+	runner.taskFactories.Range(addSchema)
+	return schemas
+}
+
+// GetInfo 設定と負荷状況を取得する
+func (runner *TaskRunner) GetInfo() TaskRunnerInfoResponse {
+	return TaskRunnerInfoResponse{Version: runner.Version, Procs: runner.GetProcNames(), Labels: runner.GetLabels(), Schemas: runner.GetParamsSchemas(), TaskRunnerStatsResponse: runner.GetStats()}
+}
+
 // GetTaskStatusResponse 指定したタスクの状態取得
 func (runner *TaskRunner) GetTaskStatusResponse(taskID string) (TaskStatusResponse, error) {
 	var response TaskStatusResponse
@@ -158,14 +368,21 @@ func (runner *TaskRunner) GetTaskStatusResponse(taskID string) (TaskStatusRespon
 		return response, err
 	}
 
+	response.ID = taskID
 	response.TaskStartRequest = status.reqData
-	if status.result != nil {
-		if status.result.Success {
+	response.Progress = status.getProgress()
+	if result := status.getResult(); result != nil {
+		switch {
+		case result.Success:
 			response.Status = StatusSuccess
-		} else {
+		case result.TimedOut:
+			response.Status = StatusTimedOut
+		case result.Cancelled:
+			response.Status = StatusCancelled
+		default:
 			response.Status = StatusFailure
 		}
-		response.ResultValues = status.result.ResultValues
+		response.ResultValues = result.ResultValues
 	} else {
 		response.Status = StatusBusy
 	}
@@ -173,10 +390,58 @@ func (runner *TaskRunner) GetTaskStatusResponse(taskID string) (TaskStatusRespon
 	return response, nil
 }
 
+// sendCallback タスク開始時に指定されたURLへタスクの完了状態を通知する
+// 通知に失敗した場合は数回再送し、それでも失敗した場合は通知側のポーリングに任せる
+func (runner *TaskRunner) sendCallback(taskID, url string) {
+	logger := runner.newTaskLogger(taskID)
+
+	status, err := runner.GetTaskStatusResponse(taskID)
+	if err != nil {
+		logger.Printf("完了通知の作成に失敗しました:%v\n", err)
+		return
+	}
+
+	for i := 0; i < callbackRetryNum; i++ {
+		if i > 0 {
+			time.Sleep(callbackRetryInterval)
+		}
+
+		err = postJSON(url, status)
+		if err == nil {
+			return
+		}
+	}
+	logger.Printf("完了通知に失敗しました URL:%v %v\n", url, err)
+}
+
+const (
+	callbackRetryNum      = 3
+	callbackRetryInterval = time.Second
+)
+
+// taskStatus TaskRunnerが管理するタスクの状態
+// resultは実行中はnilとなり、完了時に設定される
+// progressにはタスクが最後に報告した進捗、progressSending,progressSentAtには完了通知先への進捗の送信状況が入る
 type taskStatus struct {
-	result  *TaskResult
-	cancel  context.CancelFunc
-	reqData TaskStartRequest
+	resultLock      sync.Mutex
+	result          *TaskResult
+	progress        *TaskProgress
+	progressSending bool
+	progressSentAt  time.Time
+	cancel          context.CancelFunc
+	reqData         TaskStartRequest
+}
+
+func (task *taskStatus) getResult() *TaskResult {
+	task.resultLock.Lock()
+	defer task.resultLock.Unlock()
+	return task.result
+}
+
+func (task *taskStatus) setResult(result *TaskResult) {
+	task.resultLock.Lock()
+	defer task.resultLock.Unlock()
+	task.result = result
 }
 
 // getTaskStatus 指定したタスク状態を取得する
@@ -194,18 +459,39 @@ func (runner *TaskRunner) getTaskStatus(taskID string) (*taskStatus, error) {
 	return task, nil
 }
 
-func (runner *TaskRunner) newTask(req *TaskStartRequest) (Task, error) {
-	factory, ok := runner.taskFactories.Load(req.ProcName)
+// validateCallbackURL 完了通知先のURLがhttpかhttpsの絶対URLであることを確認する。空の場合は通知しないため確認しない
+func validateCallbackURL(callbackURL string) error {
+	if callbackURL == "" {
+		return nil
+	}
+	u, err := url.Parse(callbackURL)
+	if err != nil {
+		return fmt.Errorf("CallbackURLが不正です:%s", err.Error())
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("CallbackURLはhttpかhttpsのURLを指定してください:%s", callbackURL)
+	}
+	return nil
+}
+
+func (runner *TaskRunner) newTask(req *TaskStartRequest) (TaskV2, TaskFactoryOptions, error) {
+	value, ok := runner.taskFactories.Load(req.ProcName)
 	if !ok {
-		return nil, fmt.Errorf("%sに対応するファクトリが存在しません", req.ProcName)
+		return nil, TaskFactoryOptions{}, &TaskStartError{Reason: TaskStartRejectUnknownProc, Message: fmt.Sprintf("%sに対応するファクトリが存在しません", req.ProcName)}
 	}
 
-	task, err := factory.(TaskFactoryFunc)(req)
+	factory := value.(*taskFactory)
+	if factory.options.ParamsSchema != nil {
+		if violations := factory.options.ParamsSchema.ValidateParams(req.Params); len(violations) > 0 {
+			return nil, TaskFactoryOptions{}, &TaskStartError{Reason: TaskStartRejectInvalidParams, Message: fmt.Sprintf("%sのパラメータが不正です %s", req.ProcName, strings.Join(violations, ", "))}
+		}
+	}
+	task, err := factory.f(req)
 	if err != nil {
-		return nil, err
+		return nil, TaskFactoryOptions{}, &TaskStartError{Reason: TaskStartRejectInvalidParams, Message: err.Error()}
 	}
 
-	return task, nil
+	return task, factory.options, nil
 }
 
 func (runner *TaskRunner) newTaskLogger(taskID string) *log.Logger {
@@ -0,0 +1,113 @@
+package gojobcoordinatortest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// TaskRunnerClient CoordinatorがTaskRunnerのAPIを呼び出すためのクライアント
+// client.RunnerClientが実装する。CoordinatorConfigのRunnerClientFactoryを指定しない場合はパッケージ内の既定の実装を使用する
+// StartはTaskRunnerがタスク開始を拒否した場合に拒否理由を持つ*TaskStartErrorを返す
+type TaskRunnerClient interface {
+	Start(ctx context.Context, req TaskStartRequest) (TaskStartResponse, error)
+	Cancel(ctx context.Context, taskID string) error
+	Status(ctx context.Context, taskID string) (TaskStatusResponse, error)
+	Delete(ctx context.Context, taskID string) error
+	Alive(ctx context.Context) error
+	Info(ctx context.Context) (TaskRunnerInfoResponse, error)
+}
+
+// RunnerClientFactory TaskRunnerのアドレスからTaskRunnerClientを作成する関数の型
+type RunnerClientFactory func(addr string) TaskRunnerClient
+
+// defaultRunnerClient CoordinatorConfigのRunnerClientFactoryが指定されていない場合に使用するクライアント
+// 再試行はせず、1回のリクエストはjsonRequestTimeoutで打ち切る
+type defaultRunnerClient struct {
+	addr string
+}
+
+func newDefaultRunnerClient(addr string) TaskRunnerClient {
+	return &defaultRunnerClient{addr: strings.TrimSuffix(addr, "/")}
+}
+
+func (c *defaultRunnerClient) Start(ctx context.Context, req TaskStartRequest) (TaskStartResponse, error) {
+	var response TaskStartResponse
+	status, message, err := c.do(ctx, http.MethodPost, "/start", req, &response)
+	if err == nil || status == 0 {
+		return response, err
+	}
+
+	// 拒否理由が返されていればそれを返す
+	var startErr TaskStartError
+	if json.Unmarshal(message, &startErr) == nil && startErr.Reason != "" {
+		return response, &startErr
+	}
+	return response, err
+}
+
+func (c *defaultRunnerClient) Cancel(ctx context.Context, taskID string) error {
+	_, _, err := c.do(ctx, http.MethodPost, fmt.Sprint("/cancel/", taskID), nil, nil)
+	return err
+}
+
+func (c *defaultRunnerClient) Status(ctx context.Context, taskID string) (TaskStatusResponse, error) {
+	var response TaskStatusResponse
+	_, _, err := c.do(ctx, http.MethodGet, fmt.Sprint("/status/", taskID), nil, &response)
+	return response, err
+}
+
+func (c *defaultRunnerClient) Delete(ctx context.Context, taskID string) error {
+	_, _, err := c.do(ctx, http.MethodPost, fmt.Sprint("/delete/", taskID), nil, nil)
+	return err
+}
+
+func (c *defaultRunnerClient) Alive(ctx context.Context) error {
+	_, _, err := c.do(ctx, http.MethodGet, "/alive", nil, nil)
+	return err
+}
+
+func (c *defaultRunnerClient) Info(ctx context.Context) (TaskRunnerInfoResponse, error) {
+	var response TaskRunnerInfoResponse
+	_, _, err := c.do(ctx, http.MethodGet, "/info", nil, &response)
+	return response, err
+}
+
+// do pathへリクエストを送り、応答をdstへ読み込む。bodyがnilの場合はBodyを送らない
+// 200 OK以外の応答だった場合はそのStatusCodeとBodyをエラーと共に返す
+func (c *defaultRunnerClient) do(ctx context.Context, method, path string, body, dst interface{}) (int, []byte, error) {
+	url := fmt.Sprint(c.addr, path)
+	var req *http.Request
+	var err error
+	if body != nil {
+		req, err = NewJSONRequest(method, url, body)
+		if err == nil {
+			req = req.WithContext(ctx)
+		}
+	} else {
+		req, err = http.NewRequestWithContext(ctx, method, url, nil)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	res, err := jsonHTTPClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(res.Body)
+		return res.StatusCode, message, fmt.Errorf("%v %v が失敗しました StatusCode:%v %v", method, url, res.StatusCode, strings.TrimSpace(string(message)))
+	}
+	if dst != nil {
+		if err := json.NewDecoder(res.Body).Decode(dst); err != nil {
+			return res.StatusCode, nil, fmt.Errorf("%v %v の応答の解析に失敗しました:%s", method, url, err.Error())
+		}
+	}
+	return res.StatusCode, nil, nil
+}
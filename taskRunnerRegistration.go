@@ -0,0 +1,204 @@
+package gojobcoordinatortest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultHeartbeatInterval TaskRunnerRegistrationConfigのHeartbeatIntervalの既定値
+const DefaultHeartbeatInterval = time.Second * 30
+
+// runnerDrainPollInterval 退避を依頼した後、コーディネーターサーバーで退避が完了したかを確認する間隔
+const runnerDrainPollInterval = time.Second
+
+// TaskRunnerRegistrationConfig TaskRunnerをコーディネーターサーバーへ登録する際の設定項目
+// CoordinatorURL 登録先のコーディネーターサーバーのURL (例)http://localhost:8080
+// Address コーディネーターサーバーからこのTaskRunnerサーバーへアクセスする際のURL (例)http://localhost:8000
+// HeartbeatInterval 生存通知を送る間隔。0の場合はDefaultHeartbeatIntervalを使用する。
+// DrainTimeout 停止時にコーディネーターサーバーへ退避を依頼し、実行中のタスクの終了を待つ最大時間。0の場合は退避を依頼せずに登録を解除する。
+type TaskRunnerRegistrationConfig struct {
+	CoordinatorURL    string
+	Address           string
+	HeartbeatInterval time.Duration
+	DrainTimeout      time.Duration
+}
+
+// RunRegistration TaskRunnerをコーディネーターサーバーへ登録し、ctxが終了するまで定期的に生存通知を送る
+// コーディネーターサーバーが再起動して登録が失われていた場合は再登録する
+// コーディネーターサーバーで退避が完了した場合は、接続し直されるかUncordonされるまで再登録しない
+// ctxが終了した時は登録を解除してから戻る。DrainTimeoutの指定がある場合は退避が完了するまで待ってから戻る
+func (runner *TaskRunner) RunRegistration(ctx context.Context, config TaskRunnerRegistrationConfig) {
+	if config.HeartbeatInterval <= 0 {
+		config.HeartbeatInterval = DefaultHeartbeatInterval
+	}
+	coordinatorURL := strings.TrimSuffix(config.CoordinatorURL, "/")
+
+	// 退避済みの間もコーディネーターサーバーに記録が残っているため生存通知を送り続け、
+	// 記録が削除されて未登録と応答された時に再登録する
+	registered := false
+	drained := false
+	ticker := time.NewTicker(config.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		if registered {
+			response, err := runner.sendHeartbeat(coordinatorURL, config.Address)
+			if err == errRunnerNotRegistered {
+				log.Println("コーディネーターサーバーへの登録が失われたため再登録します:", coordinatorURL)
+				registered = false
+			} else if err != nil {
+				log.Println("生存通知の送信に失敗しました:", err)
+			} else if response.State == RunnerStateDrained && !drained {
+				log.Println("退避が完了したため、接続し直されるまで再登録しません:", coordinatorURL)
+				drained = true
+			}
+		}
+
+		if !registered {
+			err := runner.register(coordinatorURL, config.Address)
+			if err == errRunnerDrained {
+				log.Println("退避済みのため登録が拒否されました。接続し直されるまで再登録しません:", coordinatorURL)
+				registered, drained = true, true
+			} else if err != nil {
+				log.Println("コーディネーターサーバーへの登録に失敗しました:", err)
+			} else {
+				log.Println("コーディネーターサーバーへ登録しました:", coordinatorURL)
+				registered, drained = true, false
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if drained {
+				// 退避済みの記録は残したままにし、再起動後も再登録しないようにする
+				return
+			}
+			if registered && config.DrainTimeout > 0 {
+				runner.drain(coordinatorURL, config.Address, config.DrainTimeout)
+			}
+			if registered {
+				// 退避が完了した場合も、再起動後に登録できるよう退避済みの記録を削除させる
+				err := postJSON(fmt.Sprint(coordinatorURL, "/disconnect"), TaskRunnerConnectionRequest{Address: config.Address})
+				if err != nil {
+					log.Println("コーディネーターサーバーへの登録解除に失敗しました:", err)
+				} else {
+					log.Println("コーディネーターサーバーへの登録を解除しました:", coordinatorURL)
+				}
+			}
+			return
+		}
+	}
+}
+
+// drain コーディネーターサーバーへ退避を依頼し、実行中のタスクが終了して接続が解除されるまで最大timeoutの間待つ
+// 待っている間も生存通知を送り続け、応答の状態がRunnerStateDrainedになったら退避が完了したとみなす
+// コーディネーターサーバーの再起動などで登録が失われていた場合は、再登録して退避を依頼し直す
+func (runner *TaskRunner) drain(coordinatorURL, addr string, timeout time.Duration) {
+	if err := runner.requestDrain(coordinatorURL, addr); err != nil {
+		log.Println("コーディネーターサーバーへの退避の依頼に失敗しました:", err)
+		return
+	}
+	log.Println("コーディネーターサーバーへ退避を依頼しました:", coordinatorURL)
+
+	ticker := time.NewTicker(runnerDrainPollInterval)
+	defer ticker.Stop()
+	deadline := time.After(timeout)
+	for {
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			log.Println("退避が時間内に完了しませんでした:", coordinatorURL)
+			return
+		}
+
+		response, err := runner.sendHeartbeat(coordinatorURL, addr)
+		if err == errRunnerNotRegistered {
+			log.Println("退避中にコーディネーターサーバーへの登録が失われたため再登録して退避を依頼し直します:", coordinatorURL)
+			err = runner.register(coordinatorURL, addr)
+			if err == errRunnerDrained {
+				log.Println("退避が完了しました:", coordinatorURL)
+				return
+			}
+			if err == nil {
+				err = runner.requestDrain(coordinatorURL, addr)
+			}
+			if err != nil {
+				log.Println("コーディネーターサーバーへの退避の依頼に失敗しました:", err)
+			}
+		} else if err != nil {
+			log.Println("生存通知の送信に失敗しました:", err)
+		} else if response.State == RunnerStateDrained {
+			log.Println("退避が完了しました:", coordinatorURL)
+			return
+		}
+	}
+}
+
+// requestDrain コーディネーターサーバーへ退避を依頼する
+func (runner *TaskRunner) requestDrain(coordinatorURL, addr string) error {
+	return postJSON(fmt.Sprint(coordinatorURL, "/drain"), TaskRunnerConnectionRequest{Address: addr})
+}
+
+var (
+	// errRunnerNotRegistered 生存通知を送ったコーディネーターサーバーにTaskRunnerが登録されていない時のエラー
+	errRunnerNotRegistered = errors.New("コーディネーターサーバーに登録されていません")
+	// errRunnerDrained 退避済みのためコーディネーターサーバーに登録を拒否された時のエラー
+	errRunnerDrained = errors.New("コーディネーターサーバーで退避済みです")
+)
+
+// register コーディネーターサーバーへ登録する
+// 退避済みのため拒否された場合はerrRunnerDrainedを返す
+func (runner *TaskRunner) register(coordinatorURL, addr string) error {
+	req, err := NewJSONRequest(http.MethodPost, fmt.Sprint(coordinatorURL, "/register"), TaskRunnerRegisterRequest{Address: addr, TaskRunnerInfoResponse: runner.GetInfo()})
+	if err != nil {
+		return err
+	}
+
+	res, err := jsonHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusConflict:
+		return errRunnerDrained
+	default:
+		return fmt.Errorf("登録が拒否されました StatusCode:%v", res.StatusCode)
+	}
+}
+
+// sendHeartbeat コーディネーターサーバーへ生存通知を送り、コーディネーターサーバーでのTaskRunnerの状態を取得する
+// 登録されていないと応答された場合はerrRunnerNotRegisteredを返す
+func (runner *TaskRunner) sendHeartbeat(coordinatorURL, addr string) (TaskRunnerHeartbeatResponse, error) {
+	var response TaskRunnerHeartbeatResponse
+	req, err := NewJSONRequest(http.MethodPost, fmt.Sprint(coordinatorURL, "/heartbeat"), TaskRunnerHeartbeatRequest{Address: addr, TaskRunnerStatsResponse: runner.GetStats()})
+	if err != nil {
+		return response, err
+	}
+
+	res, err := jsonHTTPClient.Do(req)
+	if err != nil {
+		return response, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		if err := ReadJSONFromResponse(res, &response); err != nil {
+			return response, fmt.Errorf("生存通知の応答の解析に失敗しました:%s", err.Error())
+		}
+		return response, nil
+	case http.StatusNotFound:
+		return response, errRunnerNotRegistered
+	default:
+		return response, fmt.Errorf("生存通知が拒否されました StatusCode:%v", res.StatusCode)
+	}
+}
@@ -28,6 +28,11 @@ func (server *TaskRunnerServer) NewHTTPHandler() http.Handler {
 	r.HandleFunc("/delete/{taskID}", server.handleDelete).Methods("POST")
 	r.HandleFunc("/alive", server.handleAlive).Methods("GET")
 	r.HandleFunc("/tasks", server.handleTasks).Methods("GET")
+	r.HandleFunc("/stats", server.handleStats).Methods("GET")
+	r.HandleFunc("/procs", server.handleProcs).Methods("GET")
+	r.HandleFunc("/labels", server.handleLabels).Methods("GET")
+	r.HandleFunc("/schemas", server.handleSchemas).Methods("GET")
+	r.HandleFunc("/info", server.handleInfo).Methods("GET")
 	return r
 }
 
@@ -47,7 +52,20 @@ func (server *TaskRunnerServer) handleTaskStart(w http.ResponseWriter, r *http.R
 
 	response, err := server.runner.Start(requestData)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		// 拒否理由をJSONで返す。実行数の上限による拒否は時間を置けば開始できるため503とする
+		startErr, ok := err.(*TaskStartError)
+		if !ok {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		statusCode := http.StatusBadRequest
+		if startErr.Reason == TaskStartRejectCapacity {
+			statusCode = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(startErr)
 		return
 	}
 
@@ -108,3 +126,41 @@ func (server *TaskRunnerServer) handleTasks(w http.ResponseWriter, r *http.Reque
 
 	return
 }
+
+func (server *TaskRunnerServer) handleStats(w http.ResponseWriter, r *http.Request) {
+	err := json.NewEncoder(w).Encode(server.runner.GetStats())
+	if err != nil {
+		http.Error(w, fmt.Sprint("レスポンス作成に失敗しました:", err.Error()), http.StatusInternalServerError)
+	}
+}
+
+func (server *TaskRunnerServer) handleProcs(w http.ResponseWriter, r *http.Request) {
+	response := TaskProcListResponse{Procs: server.runner.GetProcNames()}
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		http.Error(w, fmt.Sprint("レスポンス作成に失敗しました:", err.Error()), http.StatusInternalServerError)
+	}
+}
+
+func (server *TaskRunnerServer) handleLabels(w http.ResponseWriter, r *http.Request) {
+	response := TaskRunnerLabelsResponse{Labels: server.runner.GetLabels()}
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		http.Error(w, fmt.Sprint("レスポンス作成に失敗しました:", err.Error()), http.StatusInternalServerError)
+	}
+}
+
+func (server *TaskRunnerServer) handleSchemas(w http.ResponseWriter, r *http.Request) {
+	response := TaskRunnerSchemasResponse{Schemas: server.runner.GetParamsSchemas()}
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		http.Error(w, fmt.Sprint("レスポンス作成に失敗しました:", err.Error()), http.StatusInternalServerError)
+	}
+}
+
+func (server *TaskRunnerServer) handleInfo(w http.ResponseWriter, r *http.Request) {
+	err := json.NewEncoder(w).Encode(server.runner.GetInfo())
+	if err != nil {
+		http.Error(w, fmt.Sprint("レスポンス作成に失敗しました:", err.Error()), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,189 @@
+package gojobcoordinatortest_test
+
+import (
+	"context"
+	"errors"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/y-akahori-ramen/gojobcoordinatortest"
+)
+
+// testFuncTask 関数をRunとして実行するタスク
+type testFuncTask func(ctx context.Context, taskID string, done chan<- *gojobcoordinatortest.TaskResult)
+
+func (task testFuncTask) Run(ctx context.Context, taskID string, logger *log.Logger, done chan<- *gojobcoordinatortest.TaskResult) {
+	task(ctx, taskID, done)
+}
+
+func newTestFuncTaskFactory(task testFuncTask) gojobcoordinatortest.TaskFactoryFunc {
+	return func(req *gojobcoordinatortest.TaskStartRequest) (gojobcoordinatortest.Task, error) {
+		return task, nil
+	}
+}
+
+// waitRunnerTaskComplete TaskRunnerでタスクが完了して実行枠が空くまで待ち、完了時の状態を返す
+func waitRunnerTaskComplete(t *testing.T, runner *gojobcoordinatortest.TaskRunner, taskID string, timeout time.Duration) string {
+	deadline := time.Now().Add(timeout)
+	for {
+		status, err := runner.GetTaskStatusResponse(taskID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Status != gojobcoordinatortest.StatusBusy && runner.GetStats().ActiveTaskNum == 0 {
+			return status.Status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("タスク %v が完了しませんでした %v", taskID, status)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestTaskRunnerCompleteWithoutRun(t *testing.T) {
+	runner := gojobcoordinatortest.NewTaskRunner(gojobcoordinatortest.TaskRunnerConfig{TaskNumMax: 1})
+	runner.AddFactory(testProcName, newTestEchoTask)
+
+	// Runを呼び出していなくてもタスクの完了が反映され、実行枠が空く
+	for i := 0; i < 3; i++ {
+		resp, err := runner.Start(gojobcoordinatortest.TaskStartRequest{ProcName: testProcName})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status := waitRunnerTaskComplete(t, runner, resp.ID, time.Second*5); status != gojobcoordinatortest.StatusSuccess {
+			t.Fatalf("unexpected status %v", status)
+		}
+	}
+}
+
+func TestTaskRunnerInvalidCallbackURL(t *testing.T) {
+	runner := gojobcoordinatortest.NewTaskRunner(gojobcoordinatortest.TaskRunnerConfig{TaskNumMax: 1})
+	runner.AddFactory(testProcName, newTestEchoTask)
+
+	// 解析できないURLやhttp以外のURLは開始時に拒否される
+	for _, callbackURL := range []string{":bad/callback", "file:///tmp/callback", "callback"} {
+		_, err := runner.Start(gojobcoordinatortest.TaskStartRequest{ProcName: testProcName, CallbackURL: callbackURL})
+		var startErr *gojobcoordinatortest.TaskStartError
+		if !errors.As(err, &startErr) || startErr.Reason != gojobcoordinatortest.TaskStartRejectInvalidParams {
+			t.Fatalf("unexpected error %v %v", callbackURL, err)
+		}
+	}
+	if _, err := gojobcoordinatortest.NewJSONRequest("POST", ":bad/callback", nil); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestTaskRunnerBrokenTasks(t *testing.T) {
+	runner := gojobcoordinatortest.NewTaskRunner(gojobcoordinatortest.TaskRunnerConfig{TaskNumMax: 1})
+	runner.AddFactory("Panic", newTestFuncTaskFactory(func(ctx context.Context, taskID string, done chan<- *gojobcoordinatortest.TaskResult) {
+		panic("test panic")
+	}))
+	runner.AddFactory("NoResult", newTestFuncTaskFactory(func(ctx context.Context, taskID string, done chan<- *gojobcoordinatortest.TaskResult) {
+	}))
+	runner.AddFactoryWithOptions("Hang", newTestFuncTaskFactory(func(ctx context.Context, taskID string, done chan<- *gojobcoordinatortest.TaskResult) {
+		<-ctx.Done()
+	}), gojobcoordinatortest.TaskFactoryOptions{MaxRuntime: time.Millisecond * 100})
+
+	// panicした場合、結果を送らずに戻った場合は失敗、最大実行時間を超えた場合は制限時間切れとなり実行枠が空く
+	expected := map[string]string{
+		"Panic":    gojobcoordinatortest.StatusFailure,
+		"NoResult": gojobcoordinatortest.StatusFailure,
+		"Hang":     gojobcoordinatortest.StatusTimedOut,
+	}
+	for _, procName := range []string{"Panic", "NoResult", "Hang"} {
+		resp, err := runner.Start(gojobcoordinatortest.TaskStartRequest{ProcName: procName})
+		if err != nil {
+			t.Fatal(procName, err)
+		}
+		if status := waitRunnerTaskComplete(t, runner, resp.ID, time.Second*5); status != expected[procName] {
+			t.Fatalf("%v: unexpected status %v", procName, status)
+		}
+	}
+}
+
+func TestTaskRunnerCancel(t *testing.T) {
+	runner := gojobcoordinatortest.NewTaskRunner(gojobcoordinatortest.TaskRunnerConfig{TaskNumMax: 1})
+	runner.AddFactory("Wait", newTestFuncTaskFactory(func(ctx context.Context, taskID string, done chan<- *gojobcoordinatortest.TaskResult) {
+		<-ctx.Done()
+		done <- &gojobcoordinatortest.TaskResult{ID: taskID, Success: false}
+	}))
+
+	// キャンセルにより成功しなかったタスクは失敗ではなくキャンセルとなる
+	resp, err := runner.Start(gojobcoordinatortest.TaskStartRequest{ProcName: "Wait"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.CancelReq(resp.ID); err != nil {
+		t.Fatal(err)
+	}
+	if status := waitRunnerTaskComplete(t, runner, resp.ID, time.Second*5); status != gojobcoordinatortest.StatusCancelled {
+		t.Fatalf("unexpected status %v", status)
+	}
+}
+
+func TestTaskRunnerTimeout(t *testing.T) {
+	runner := gojobcoordinatortest.NewTaskRunner(gojobcoordinatortest.TaskRunnerConfig{TaskNumMax: 2})
+	runner.AddFactory("Wait", newTestFuncTaskFactory(func(ctx context.Context, taskID string, done chan<- *gojobcoordinatortest.TaskResult) {
+		if _, ok := ctx.Deadline(); !ok {
+			done <- &gojobcoordinatortest.TaskResult{ID: taskID, Success: false}
+			return
+		}
+		<-ctx.Done()
+		done <- &gojobcoordinatortest.TaskResult{ID: taskID, Success: false}
+	}))
+
+	// TimeoutSecとDeadlineのどちらを過ぎた場合もctxが終了し、制限時間切れとなる
+	deadline := time.Now().Add(time.Millisecond * 100)
+	for _, req := range []gojobcoordinatortest.TaskStartRequest{
+		{ProcName: "Wait", TimeoutSec: 0.1},
+		{ProcName: "Wait", Deadline: &deadline},
+	} {
+		resp, err := runner.Start(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status := waitRunnerTaskComplete(t, runner, resp.ID, time.Second*5); status != gojobcoordinatortest.StatusTimedOut {
+			t.Fatalf("unexpected status %v", status)
+		}
+	}
+}
+
+func TestTaskRunnerProgress(t *testing.T) {
+	if gojobcoordinatortest.ReportProgress(context.Background(), gojobcoordinatortest.TaskProgress{Fraction: 0.5}) {
+		t.Fatal("タスク以外のctxで進捗を報告できました")
+	}
+
+	reported := make(chan struct{})
+	finish := make(chan struct{})
+	runner := gojobcoordinatortest.NewTaskRunner(gojobcoordinatortest.TaskRunnerConfig{TaskNumMax: 1})
+	runner.AddFactory("Progress", newTestFuncTaskFactory(func(ctx context.Context, taskID string, done chan<- *gojobcoordinatortest.TaskResult) {
+		values := map[string]interface{}{"processed": 5.0}
+		gojobcoordinatortest.ReportProgress(ctx, gojobcoordinatortest.TaskProgress{Fraction: 1.5, Message: "too much"})
+		gojobcoordinatortest.ReportProgress(ctx, gojobcoordinatortest.TaskProgress{Fraction: 0.5, Message: "half", Values: &values})
+		close(reported)
+		<-finish
+		done <- &gojobcoordinatortest.TaskResult{ID: taskID, Success: true}
+	}))
+
+	resp, err := runner.Start(gojobcoordinatortest.TaskStartRequest{ProcName: "Progress"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-reported
+
+	// 最後に報告した進捗が状態に含まれる
+	status, err := runner.GetTaskStatusResponse(resp.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != gojobcoordinatortest.StatusBusy || status.Progress == nil || status.Progress.Fraction != 0.5 || status.Progress.Message != "half" ||
+		(*status.Progress.Values)["processed"] != 5.0 || status.Progress.UpdatedAt.IsZero() {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	close(finish)
+	if status := waitRunnerTaskComplete(t, runner, resp.ID, time.Second*5); status != gojobcoordinatortest.StatusSuccess {
+		t.Fatalf("unexpected status %v", status)
+	}
+}
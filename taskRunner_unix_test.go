@@ -0,0 +1,43 @@
+//go:build !windows
+// +build !windows
+
+package gojobcoordinatortest_test
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/y-akahori-ramen/gojobcoordinatortest"
+)
+
+// processCPUTime プロセスがこれまでに使用したCPU時間を取得する
+func processCPUTime(b *testing.B) time.Duration {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		b.Fatal(err)
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
+
+// BenchmarkTaskRunnerIdle タスクを実行していないTaskRunnerのCPU使用率を計測する
+// cpu-ratioは経過時間に対するCPU時間の割合で、1がCPUコア1つを使い切っている状態を表す
+func BenchmarkTaskRunnerIdle(b *testing.B) {
+	const idleDuration = time.Millisecond * 100
+
+	var cpuTime, wallTime time.Duration
+	for i := 0; i < b.N; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		runner := gojobcoordinatortest.NewTaskRunner(gojobcoordinatortest.TaskRunnerConfig{TaskNumMax: 1})
+		go runner.Run(ctx)
+
+		startCPU, start := processCPUTime(b), time.Now()
+		time.Sleep(idleDuration)
+		cpuTime += processCPUTime(b) - startCPU
+		wallTime += time.Since(start)
+
+		cancel()
+	}
+	b.ReportMetric(float64(cpuTime)/float64(wallTime), "cpu-ratio")
+}
@@ -0,0 +1,120 @@
+package gojobcoordinatortest
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// TypedProc パラメータと結果の型を持つ処理名
+// TaskRunnerへの登録とTaskStartRequestの作成、結果値の取得で同じ定義を使用することで、パラメータと結果値を構造体で扱える
+// パラメータと結果値はJSONを経由してmap型と相互に変換されるため、Pには"json"タグで名前を指定できる
+type TypedProc[P any, R any] struct {
+	ProcName string
+}
+
+// NewTypedProc パラメータと結果の型を指定して処理名を定義する
+func NewTypedProc[P any, R any](procName string) TypedProc[P, R] {
+	return TypedProc[P, R]{ProcName: procName}
+}
+
+// ParamsValidator パラメータの検証を行う型が実装するインターフェイス
+// TypedProcのパラメータの型が実装している場合、タスク開始時にValidateが呼ばれエラーを返すとタスク開始が拒否される
+type ParamsValidator interface {
+	Validate() error
+}
+
+// TypedTaskFunc 型付きのパラメータを受け取り、型付きの結果を返すタスク処理
+// エラーを返した場合はタスクの失敗として扱う。ctxが終了して戻った場合はキャンセルか制限時間切れとして扱われる
+type TypedTaskFunc[P any, R any] func(ctx context.Context, taskID string, logger *log.Logger, params P) (R, error)
+
+// ParamsSchema パラメータの型から作成したスキーマを取得する
+func (proc TypedProc[P, R]) ParamsSchema() *ParamsSchema {
+	return ParamsSchemaOf[P]()
+}
+
+// NewRequest パラメータを指定してタスク開始リクエストを作成する
+func (proc TypedProc[P, R]) NewRequest(params P) (TaskStartRequest, error) {
+	mapData, err := StructToMap(params)
+	if err != nil {
+		return TaskStartRequest{}, fmt.Errorf("%sのパラメータ変換に失敗しました:%s", proc.ProcName, err.Error())
+	}
+	return TaskStartRequest{ProcName: proc.ProcName, Params: &mapData}, nil
+}
+
+// DecodeParams タスク開始リクエストのパラメータを型付きのパラメータへ変換し、検証する
+func (proc TypedProc[P, R]) DecodeParams(req *TaskStartRequest) (P, error) {
+	var params P
+	if req.ProcName != proc.ProcName {
+		return params, fmt.Errorf("処理名 %s が不正です", req.ProcName)
+	}
+
+	if req.Params != nil {
+		if err := MapToStruct(*req.Params, &params); err != nil {
+			return params, fmt.Errorf("%sのパラメータが不正です:%s", proc.ProcName, err.Error())
+		}
+	}
+
+	if validator, ok := any(&params).(ParamsValidator); ok {
+		if err := validator.Validate(); err != nil {
+			return params, fmt.Errorf("%sのパラメータが不正です:%s", proc.ProcName, err.Error())
+		}
+	}
+	return params, nil
+}
+
+// DecodeResult 完了したタスクの結果値を型付きの結果へ変換する
+func (proc TypedProc[P, R]) DecodeResult(status TaskStatusResponse) (R, error) {
+	var result R
+	if status.ResultValues == nil {
+		return result, nil
+	}
+	if err := MapToStruct(*status.ResultValues, &result); err != nil {
+		return result, fmt.Errorf("%sの結果値の変換に失敗しました:%s", proc.ProcName, err.Error())
+	}
+	return result, nil
+}
+
+// AddTypedTask 型付きのタスク処理を登録する
+func AddTypedTask[P any, R any](runner *TaskRunner, proc TypedProc[P, R], f TypedTaskFunc[P, R]) error {
+	return AddTypedTaskWithOptions(runner, proc, f, TaskFactoryOptions{})
+}
+
+// AddTypedTaskWithOptions 設定を指定して型付きのタスク処理を登録する
+// options.ParamsSchemaの指定がない場合はパラメータの型から作成したスキーマを使用する
+func AddTypedTaskWithOptions[P any, R any](runner *TaskRunner, proc TypedProc[P, R], f TypedTaskFunc[P, R], options TaskFactoryOptions) error {
+	if f == nil {
+		return fmt.Errorf("%sに登録される処理がnilです", proc.ProcName)
+	}
+	if options.ParamsSchema == nil {
+		options.ParamsSchema = proc.ParamsSchema()
+	}
+
+	factory := func(req *TaskStartRequest) (TaskV2, error) {
+		params, err := proc.DecodeParams(req)
+		if err != nil {
+			return nil, err
+		}
+		return &typedTask[P, R]{f: f, params: params}, nil
+	}
+	return runner.AddFactoryV2WithOptions(proc.ProcName, factory, options)
+}
+
+// typedTask 型付きのタスク処理をTaskV2として実行する
+type typedTask[P any, R any] struct {
+	f      TypedTaskFunc[P, R]
+	params P
+}
+
+func (task *typedTask[P, R]) Run(tc TaskContext) (map[string]interface{}, error) {
+	result, err := task.f(tc.Context(), tc.TaskID(), tc.Logger().StdLogger(), task.params)
+	if err != nil {
+		return nil, err
+	}
+
+	resultValues, err := StructToMap(result)
+	if err != nil {
+		return nil, fmt.Errorf("結果値の変換に失敗しました:%s", err.Error())
+	}
+	return resultValues, nil
+}
@@ -0,0 +1,76 @@
+package gojobcoordinatortest_test
+
+import (
+	"context"
+	"errors"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/y-akahori-ramen/gojobcoordinatortest"
+)
+
+type testAddParams struct {
+	A int `json:"a"`
+	B int `json:"b"`
+}
+
+func (params *testAddParams) Validate() error {
+	if params.A < 0 || params.B < 0 {
+		return errors.New("負の値は指定できません")
+	}
+	return nil
+}
+
+type testAddResult struct {
+	Sum int `json:"sum"`
+}
+
+var testAddProc = gojobcoordinatortest.NewTypedProc[testAddParams, testAddResult]("TestAdd")
+
+func TestTypedTask(t *testing.T) {
+	runner := gojobcoordinatortest.NewTaskRunner(gojobcoordinatortest.TaskRunnerConfig{TaskNumMax: 1})
+	err := gojobcoordinatortest.AddTypedTask(runner, testAddProc, func(ctx context.Context, taskID string, logger *log.Logger, params testAddParams) (testAddResult, error) {
+		return testAddResult{Sum: params.A + params.B}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := testAddProc.NewRequest(testAddParams{A: 1, B: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := runner.Start(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := waitRunnerTaskComplete(t, runner, resp.ID, time.Second*5); status != gojobcoordinatortest.StatusSuccess {
+		t.Fatalf("unexpected status %v", status)
+	}
+
+	status, err := runner.GetTaskStatusResponse(resp.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := testAddProc.DecodeResult(status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Sum != 3 {
+		t.Fatalf("unexpected result %v", result)
+	}
+
+	// 型が一致しないパラメータや検証に失敗したパラメータは開始が拒否される
+	for _, params := range []map[string]interface{}{
+		{"a": "1", "b": 2},
+		{"a": -1, "b": 2},
+	} {
+		params := params
+		_, err := runner.Start(gojobcoordinatortest.TaskStartRequest{ProcName: testAddProc.ProcName, Params: &params})
+		var startErr *gojobcoordinatortest.TaskStartError
+		if !errors.As(err, &startErr) || startErr.Reason != gojobcoordinatortest.TaskStartRejectInvalidParams {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+}